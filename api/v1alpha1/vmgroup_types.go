@@ -17,6 +17,8 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -33,11 +35,283 @@ type VmGroupSpec struct {
 	// +kubebuilder:validation:Minimum=1
 	// +kubebuilder:validation:Maximum=8
 	Memory int32 `json:"memory"`
+	// Template is the name or inventory path of the template replicas are
+	// cloned from. Exactly one of template, contentLibrary or templateRef
+	// must be set.
+	// +kubebuilder:validation:Optional
+	Template string `json:"template,omitempty"`
+	// ContentLibrary references a template in a content library replicas are
+	// deployed from instead of template. Replicas are always full copies.
+	// +kubebuilder:validation:Optional
+	ContentLibrary *ContentLibraryItem `json:"contentLibrary,omitempty"`
+	// TemplateRef references a VmTemplate in the same namespace. Replicas are
+	// replaced one at a time when a new template version is promoted.
+	// +kubebuilder:validation:Optional
+	TemplateRef *corev1.LocalObjectReference `json:"templateRef,omitempty"`
+	// Replicas is the number of VMs. 0 hibernates the VmGroup, keeping the
+	// group folder and configuration, see scaleToZeroPolicy.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Minimum=0
+	Replicas int32 `json:"replicas"`
+	// +kubebuilder:validation:Optional
+	Placement *Placement `json:"placement,omitempty"`
+	// +kubebuilder:validation:Optional
+	TopologySpread *TopologySpread `json:"topologySpread,omitempty"`
+	// CloneMode defines how replicas are cloned from the template, defaults
+	// to full. Instant clones require template to be a running VM and
+	// inherit CPU and memory from it. Content library items are always
+	// deployed as full clones.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=full;linked;instant
+	CloneMode CloneMode `json:"cloneMode,omitempty"`
+	// TemplateSnapshot is the snapshot of the template linked clones are
+	// created from. Created if absent, defaults to "vm-operator-linked-clone".
+	// +kubebuilder:validation:Optional
+	TemplateSnapshot string `json:"templateSnapshot,omitempty"`
+	// Paused stops all changes to replicas in vCenter, e.g. during
+	// maintenance. Only the status is refreshed while paused.
+	// +kubebuilder:validation:Optional
+	Paused bool `json:"paused,omitempty"`
+	// AdoptionPolicy defines whether VMs in the group folder without owner are
+	// adopted as replicas, defaults to legacy. Replicas are marked with the
+	// VmGroup UID in the "vm-operator.vmgroup" custom attribute, VMs owned by
+	// other VmGroups are never adopted. Unadopted VMs are never changed or
+	// deleted.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=never;legacy;unowned
+	AdoptionPolicy AdoptionPolicy `json:"adoptionPolicy,omitempty"`
+	// Tags are vSphere tags attached to the group folder and replicas in
+	// addition to the "k8s-vmgroup" owner tags, e.g. for cost centers.
+	// Categories and tags are created if absent, tags removed from the list
+	// are detached.
+	// +kubebuilder:validation:Optional
+	Tags []Tag `json:"tags,omitempty"`
+	// DeletionPolicy defines what happens to replicas when the VmGroup is
+	// deleted, defaults to Delete. Retain removes the ownership attribute and
+	// owner tags but keeps the replicas, Orphan leaves everything in vCenter
+	// untouched.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=Delete;Retain;Orphan
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+	// RetainFolder is the inventory path of the VM folder retained replicas
+	// are moved to. If empty, replicas are kept in the group folder.
+	// +kubebuilder:validation:Optional
+	RetainFolder string `json:"retainFolder,omitempty"`
+	// Archive keeps a recoverable copy of replicas before they are deleted,
+	// e.g. on scale down
+	// +kubebuilder:validation:Optional
+	Archive *Archive `json:"archive,omitempty"`
+	// PowerState is the desired power state of all replicas, defaults to
+	// poweredOn
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=poweredOn;poweredOff
+	PowerState PowerState `json:"powerState,omitempty"`
+	// ScaleToZeroPolicy defines what happens to replicas when replicas is 0,
+	// defaults to Delete. PowerOff keeps the replicas powered off, they are
+	// powered on again when scaling up.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=Delete;PowerOff
+	ScaleToZeroPolicy ScaleToZeroPolicy `json:"scaleToZeroPolicy,omitempty"`
+	// Service publishes the guest IPs of the replicas as a Service without
+	// selector named like the VmGroup. Endpoints and EndpointSlices are kept
+	// in sync with the IPv4 addresses reported by VMware Tools.
+	// +kubebuilder:validation:Optional
+	Service *ServiceSpec `json:"service,omitempty"`
+	// Network is the name or inventory path of the network the first NIC of
+	// replicas is connected to, defaults to the network of the template
+	// +kubebuilder:validation:Optional
+	Network string `json:"network,omitempty"`
+}
+
+// ServiceSpec defines the Service of a VmGroup
+type ServiceSpec struct {
+	// Headless creates a Service without cluster IP, changing it recreates
+	// the Service
+	// +kubebuilder:validation:Optional
+	Headless bool `json:"headless,omitempty"`
 	// +kubebuilder:validation:Required
-	Template string `json:"template"`
+	// +kubebuilder:validation:MinItems=1
+	Ports []ServicePort `json:"ports"`
+}
+
+// ServicePort is a port of the Service of a VmGroup
+type ServicePort struct {
+	// Name is required if more than one port is set
+	// +kubebuilder:validation:Optional
+	Name string `json:"name,omitempty"`
+	// Protocol defaults to TCP
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=TCP;UDP;SCTP
+	Protocol corev1.Protocol `json:"protocol,omitempty"`
 	// +kubebuilder:validation:Required
 	// +kubebuilder:validation:Minimum=1
-	Replicas int32 `json:"replicas"`
+	// +kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port"`
+	// TargetPort is the port on the replicas, defaults to port
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	TargetPort int32 `json:"targetPort,omitempty"`
+}
+
+type ScaleToZeroPolicy string
+
+const (
+	DeleteScaleToZeroPolicy   ScaleToZeroPolicy = "Delete"
+	PowerOffScaleToZeroPolicy ScaleToZeroPolicy = "PowerOff"
+)
+
+type PowerState string
+
+const (
+	PoweredOnPowerState  PowerState = "poweredOn"
+	PoweredOffPowerState PowerState = "poweredOff"
+)
+
+// Archive defines how replicas are archived before deletion. Archives are
+// stored per VmGroup in a subfolder (or directory) of the group name.
+type Archive struct {
+	// Mode is template (snapshot and mark the replica as template), clone
+	// (clone the replica powered off) or ovf (export the replica)
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Enum=template;clone;ovf
+	Mode ArchiveMode `json:"mode"`
+	// Folder is the inventory path of the VM folder for template and clone
+	// archives
+	// +kubebuilder:validation:Optional
+	Folder string `json:"folder,omitempty"`
+	// Path is the local directory of the operator OVF archives are exported
+	// to. It must be on a volume mounted into the operator, e.g. /archive of
+	// config/archive, the container filesystem is lost on restart.
+	// +kubebuilder:validation:Optional
+	Path string `json:"path,omitempty"`
+	// Retention is the number of archives kept per VmGroup, older archives
+	// are deleted. All archives are kept if 0.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	Retention int32 `json:"retention,omitempty"`
+}
+
+type ArchiveMode string
+
+const (
+	TemplateArchiveMode ArchiveMode = "template"
+	CloneArchiveMode    ArchiveMode = "clone"
+	OVFArchiveMode      ArchiveMode = "ovf"
+)
+
+type DeletionPolicy string
+
+const (
+	// DeleteDeletionPolicy deletes all replicas and the group folder
+	DeleteDeletionPolicy DeletionPolicy = "Delete"
+	// RetainDeletionPolicy keeps replicas without ownership
+	RetainDeletionPolicy DeletionPolicy = "Retain"
+	// OrphanDeletionPolicy does not change anything in vCenter
+	OrphanDeletionPolicy DeletionPolicy = "Orphan"
+)
+
+// Tag is a vSphere tag
+type Tag struct {
+	// +kubebuilder:validation:Required
+	Category string `json:"category"`
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+}
+
+// ContentLibraryItem references an OVF or VM template item in a content library
+type ContentLibraryItem struct {
+	// +kubebuilder:validation:Required
+	Library string `json:"library"`
+	// +kubebuilder:validation:Required
+	Item string `json:"item"`
+}
+
+type AdoptionPolicy string
+
+const (
+	// NeverAdoptionPolicy ignores all unmarked VMs
+	NeverAdoptionPolicy AdoptionPolicy = "never"
+	// LegacyAdoptionPolicy adopts unmarked VMs named like replicas
+	// ("<name>-replica-*"), e.g. created by older versions
+	LegacyAdoptionPolicy AdoptionPolicy = "legacy"
+	// UnownedAdoptionPolicy adopts VMs without owner as replicas
+	UnownedAdoptionPolicy AdoptionPolicy = "unowned"
+)
+
+type CloneMode string
+
+const (
+	FullCloneMode    CloneMode = "full"
+	LinkedCloneMode  CloneMode = "linked"
+	InstantCloneMode CloneMode = "instant"
+)
+
+// Placement defines where replicas are created in vCenter. Unset fields fall
+// back to the operator defaults (default resource pool and VM folder).
+type Placement struct {
+	// Cluster is the name or inventory path of the compute cluster. If no
+	// resource pool is given, the cluster root resource pool is used.
+	// +kubebuilder:validation:Optional
+	Cluster string `json:"cluster,omitempty"`
+	// ResourcePool is the name or inventory path of the resource pool
+	// +kubebuilder:validation:Optional
+	ResourcePool string `json:"resourcePool,omitempty"`
+	// Host is the name or inventory path of the ESXi host replicas are pinned to
+	// +kubebuilder:validation:Optional
+	Host string `json:"host,omitempty"`
+	// HostSelector is an inventory path pattern (e.g. "esx-*") matching the
+	// ESXi hosts replicas are spread across. Ignored if Host is set.
+	// +kubebuilder:validation:Optional
+	HostSelector string `json:"hostSelector,omitempty"`
+	// Folder is the inventory path of the VM folder the group folder is
+	// created in
+	// +kubebuilder:validation:Optional
+	Folder string `json:"folder,omitempty"`
+	// AntiAffinity spreads replicas across ESXi hosts with a DRS VM-VM
+	// anti-affinity rule. Requires replicas to be placed in a DRS cluster.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=required;preferred
+	AntiAffinity AntiAffinityPolicy `json:"antiAffinity,omitempty"`
+}
+
+type AntiAffinityPolicy string
+
+const (
+	// RequiredAntiAffinity creates a mandatory DRS rule
+	RequiredAntiAffinity AntiAffinityPolicy = "required"
+	// PreferredAntiAffinity creates a non-mandatory DRS rule
+	PreferredAntiAffinity AntiAffinityPolicy = "preferred"
+)
+
+// TopologySpread distributes replicas evenly across failure zones. Zones
+// replace the cluster, resource pool and host settings of the placement.
+type TopologySpread struct {
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinItems=1
+	Zones []Zone `json:"zones"`
+	// MaxSkew is the maximum allowed difference in replicas between zones
+	// before replicas are rebalanced, defaults to 1
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	MaxSkew int32 `json:"maxSkew,omitempty"`
+}
+
+// Zone is a failure zone replicas are placed in. Each zone must resolve to a
+// distinct resource pool.
+type Zone struct {
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+	// Cluster is the name or inventory path of the compute cluster
+	// +kubebuilder:validation:Optional
+	Cluster string `json:"cluster,omitempty"`
+	// ResourcePool is the name or inventory path of the resource pool
+	// +kubebuilder:validation:Optional
+	ResourcePool string `json:"resourcePool,omitempty"`
+	// Datastore is the name or inventory path of the datastore for replica
+	// disks, defaults to the template datastore
+	// +kubebuilder:validation:Optional
+	Datastore string `json:"datastore,omitempty"`
 }
 
 type StatusPhase string
@@ -46,6 +320,12 @@ const (
 	RunningStatusPhase StatusPhase = "RUNNING"
 	PendingStatusPhase StatusPhase = "PENDING"
 	ErrorStatusPhase   StatusPhase = "ERROR"
+	// TimeoutStatusPhase is set when a vCenter operation exceeded its timeout
+	TimeoutStatusPhase StatusPhase = "TIMEOUT"
+	// PausedStatusPhase is set while changes to replicas are paused
+	PausedStatusPhase StatusPhase = "PAUSED"
+	// HibernatedStatusPhase is set when a VmGroup is scaled to zero
+	HibernatedStatusPhase StatusPhase = "HIBERNATED"
 )
 
 // VmGroupStatus defines the observed state of VmGroup
@@ -54,16 +334,64 @@ type VmGroupStatus struct {
 	Phase           StatusPhase `json:"phase"`
 	CurrentReplicas *int32      `json:"currentReplicas,omitempty"`
 	DesiredReplicas int32       `json:"desiredReplicas"`
-	LastMessage     string      `json:"lastMessage"`
+	// ReadyReplicas is the number of powered on replicas with a healthy guest
+	// heartbeat, reported in the scale subresource
+	ReadyReplicas int32 `json:"readyReplicas"`
+	// Selector is the label selector of the replicas in the scale subresource
+	Selector    string `json:"selector,omitempty"`
+	LastMessage string `json:"lastMessage"`
+	// CloneMode replicas were provisioned with, set when the group is running
+	CloneMode CloneMode `json:"cloneMode,omitempty"`
+	// TemplateVersion of the referenced VmTemplate all replicas are built
+	// from, set when the group is running
+	TemplateVersion string `json:"templateVersion,omitempty"`
+	// Folder is the inventory path of the parent folder of the group folder,
+	// set once the group folder exists. Replicas stay in this folder when the
+	// placement folder or the VmNamespaceConfig of the namespace change.
+	Folder string `json:"folder,omitempty"`
+	// Service is the name of the Service of the replicas, set while
+	// spec.service is set
+	Service string `json:"service,omitempty"`
+	// Tags are the spec.tags attached to the group folder and replicas. Tags
+	// removed from spec.tags are detached on the next reconcile.
+	Tags []Tag `json:"tags,omitempty"`
+	// IgnoredVMs are VMs in the group folder not owned by the VmGroup. They
+	// are never changed or deleted by the operator.
+	IgnoredVMs []string `json:"ignoredVMs,omitempty"`
+	// ReplicaDisk is the provisioned disk capacity of a replica, set if disk
+	// is limited by a VmQuota in the namespace
+	ReplicaDisk *resource.Quantity `json:"replicaDisk,omitempty"`
+	// Conditions are the latest observations of the VmGroup, e.g.
+	// QuotaExceeded if scale-ups are capped by a VmQuota
+	Conditions []Condition `json:"conditions,omitempty"`
+}
+
+// ConditionType is the type of a Condition
+type ConditionType string
+
+const (
+	// QuotaExceededCondition is true if the replicas are capped below
+	// spec.replicas by a VmQuota
+	QuotaExceededCondition ConditionType = "QuotaExceeded"
+)
+
+// Condition is an observation of the state of a resource
+type Condition struct {
+	Type               ConditionType          `json:"type"`
+	Status             corev1.ConditionStatus `json:"status"`
+	Reason             string                 `json:"reason,omitempty"`
+	Message            string                 `json:"message,omitempty"`
+	LastTransitionTime metav1.Time            `json:"lastTransitionTime"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:validation:Optional
 // +kubebuilder:subresource:status
-// +kubebuilder:subresource:scale:specpath=.spec.replicas,statuspath=.status.desiredReplicas
+// +kubebuilder:subresource:scale:specpath=.spec.replicas,statuspath=.status.readyReplicas,selectorpath=.status.selector
 // +kubebuilder:resource:shortName={"vg"}
 // +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
 // +kubebuilder:printcolumn:name="Current",type=integer,JSONPath=`.status.currentReplicas`
+// +kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.readyReplicas`
 // +kubebuilder:printcolumn:name="Desired",type=integer,JSONPath=`.spec.replicas`
 // +kubebuilder:printcolumn:name="CPU",type=integer,JSONPath=`.spec.cpu`
 // +kubebuilder:printcolumn:name="Memory",type=integer,JSONPath=`.spec.memory`
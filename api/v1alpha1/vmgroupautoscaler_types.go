@@ -0,0 +1,119 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// VmGroupAutoscalerSpec defines the desired state of VmGroupAutoscaler
+type VmGroupAutoscalerSpec struct {
+	// ScaleTargetRef references the VmGroup in the same namespace whose
+	// replicas are scaled
+	// +kubebuilder:validation:Required
+	ScaleTargetRef corev1.LocalObjectReference `json:"scaleTargetRef"`
+	// MinReplicas defaults to 1
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Minimum=1
+	MaxReplicas int32 `json:"maxReplicas"`
+	// TargetCPUUtilization is the average CPU usage of the replicas in
+	// percent (cpu.usage.average). At least one target must be set, the
+	// highest resulting replica count wins.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	TargetCPUUtilization *int32 `json:"targetCPUUtilization,omitempty"`
+	// TargetMemoryUtilization is the average memory usage of the replicas in
+	// percent (mem.usage.average)
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	TargetMemoryUtilization *int32 `json:"targetMemoryUtilization,omitempty"`
+	// ScaleUpStabilizationSeconds is the window of recommendations considered
+	// for scaling up, the lowest recommendation is used. Defaults to 0.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	ScaleUpStabilizationSeconds *int32 `json:"scaleUpStabilizationSeconds,omitempty"`
+	// ScaleDownStabilizationSeconds is the window of recommendations
+	// considered for scaling down, the highest recommendation is used.
+	// Defaults to 300.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	ScaleDownStabilizationSeconds *int32 `json:"scaleDownStabilizationSeconds,omitempty"`
+}
+
+// VmGroupAutoscalerStatus defines the observed state of VmGroupAutoscaler
+type VmGroupAutoscalerStatus struct {
+	// +kubebuilder:validation:Optional
+	Phase           StatusPhase `json:"phase"`
+	CurrentReplicas int32       `json:"currentReplicas"`
+	DesiredReplicas int32       `json:"desiredReplicas"`
+	// CurrentCPUUtilization is the average CPU usage of the replicas in percent
+	CurrentCPUUtilization *int32 `json:"currentCPUUtilization,omitempty"`
+	// CurrentMemoryUtilization is the average memory usage of the replicas in
+	// percent
+	CurrentMemoryUtilization *int32       `json:"currentMemoryUtilization,omitempty"`
+	LastScaleTime            *metav1.Time `json:"lastScaleTime,omitempty"`
+	// Recommendations within the stabilization windows, oldest first
+	Recommendations []Recommendation `json:"recommendations,omitempty"`
+	LastMessage     string           `json:"lastMessage"`
+}
+
+// Recommendation is a replica count computed from the utilization at a time
+type Recommendation struct {
+	Replicas int32       `json:"replicas"`
+	Time     metav1.Time `json:"time"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:validation:Optional
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:shortName={"vga"}
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="VmGroup",type=string,JSONPath=`.spec.scaleTargetRef.name`
+// +kubebuilder:printcolumn:name="Min",type=integer,JSONPath=`.spec.minReplicas`
+// +kubebuilder:printcolumn:name="Max",type=integer,JSONPath=`.spec.maxReplicas`
+// +kubebuilder:printcolumn:name="Current",type=integer,JSONPath=`.status.currentReplicas`
+// +kubebuilder:printcolumn:name="CPU",type=integer,JSONPath=`.status.currentCPUUtilization`
+// +kubebuilder:printcolumn:name="Memory",type=integer,JSONPath=`.status.currentMemoryUtilization`
+// +kubebuilder:printcolumn:name="Last_Message",type=string,JSONPath=`.status.lastMessage`
+
+// VmGroupAutoscaler is the Schema for the vmgroupautoscalers API
+type VmGroupAutoscaler struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   VmGroupAutoscalerSpec   `json:"spec,omitempty"`
+	Status VmGroupAutoscalerStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// VmGroupAutoscalerList contains a list of VmGroupAutoscaler
+type VmGroupAutoscalerList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VmGroupAutoscaler `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&VmGroupAutoscaler{}, &VmGroupAutoscalerList{})
+}
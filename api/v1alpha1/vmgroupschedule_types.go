@@ -0,0 +1,101 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// VmGroupScheduleSpec defines the desired state of VmGroupSchedule
+type VmGroupScheduleSpec struct {
+	// VmGroupRef references the VmGroup in the same namespace the actions
+	// are applied to
+	// +kubebuilder:validation:Required
+	VmGroupRef corev1.LocalObjectReference `json:"vmGroupRef"`
+	// TimeZone is the IANA time zone of the schedules, e.g. "Europe/Berlin",
+	// defaults to UTC
+	// +kubebuilder:validation:Optional
+	TimeZone string `json:"timeZone,omitempty"`
+	// Actions patch the VmGroup at the times of their schedule. If several
+	// actions are due, only the latest is applied.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinItems=1
+	Actions []ScheduleAction `json:"actions"`
+}
+
+// ScheduleAction patches the replicas and/or power state of a VmGroup
+type ScheduleAction struct {
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+	// Schedule is a cron expression, e.g. "0 20 * * 1-5"
+	// +kubebuilder:validation:Required
+	Schedule string `json:"schedule"`
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	Replicas *int32 `json:"replicas,omitempty"`
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=poweredOn;poweredOff
+	PowerState PowerState `json:"powerState,omitempty"`
+}
+
+// VmGroupScheduleStatus defines the observed state of VmGroupSchedule
+type VmGroupScheduleStatus struct {
+	// +kubebuilder:validation:Optional
+	Phase       StatusPhase            `json:"phase"`
+	LastAction  *ScheduledActionStatus `json:"lastAction,omitempty"`
+	NextAction  *ScheduledActionStatus `json:"nextAction,omitempty"`
+	LastMessage string                 `json:"lastMessage"`
+}
+
+// ScheduledActionStatus is an applied or upcoming action
+type ScheduledActionStatus struct {
+	Name string      `json:"name"`
+	Time metav1.Time `json:"time"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:validation:Optional
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:shortName={"vgsched"}
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="VmGroup",type=string,JSONPath=`.spec.vmGroupRef.name`
+// +kubebuilder:printcolumn:name="Last_Action",type=string,JSONPath=`.status.lastAction.name`
+// +kubebuilder:printcolumn:name="Next_Action",type=string,JSONPath=`.status.nextAction.name`
+// +kubebuilder:printcolumn:name="Next_Time",type=string,JSONPath=`.status.nextAction.time`
+
+// VmGroupSchedule is the Schema for the vmgroupschedules API
+type VmGroupSchedule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   VmGroupScheduleSpec   `json:"spec,omitempty"`
+	Status VmGroupScheduleStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// VmGroupScheduleList contains a list of VmGroupSchedule
+type VmGroupScheduleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VmGroupSchedule `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&VmGroupSchedule{}, &VmGroupScheduleList{})
+}
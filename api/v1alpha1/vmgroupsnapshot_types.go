@@ -0,0 +1,114 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// VmGroupSnapshotSpec defines the desired state of VmGroupSnapshot
+type VmGroupSnapshotSpec struct {
+	// VmGroupRef references the VmGroup in the same namespace whose replicas
+	// are snapshotted
+	// +kubebuilder:validation:Required
+	VmGroupRef corev1.LocalObjectReference `json:"vmGroupRef"`
+	// SnapshotName is the name of the vSphere snapshot, defaults to the name
+	// of the VmGroupSnapshot. Scheduled snapshots are suffixed with a timestamp.
+	// +kubebuilder:validation:Optional
+	SnapshotName string `json:"snapshotName,omitempty"`
+	// Quiesce the guest file system, requires VMware Tools
+	// +kubebuilder:validation:Optional
+	Quiesce bool `json:"quiesce,omitempty"`
+	// Memory includes the memory of powered on replicas in the snapshot
+	// +kubebuilder:validation:Optional
+	Memory bool `json:"memory,omitempty"`
+	// Schedule is a cron expression, e.g. "0 2 * * *". If empty, a single
+	// snapshot is taken.
+	// +kubebuilder:validation:Optional
+	Schedule string `json:"schedule,omitempty"`
+	// Retention is the number of scheduled snapshots kept, older snapshots
+	// are deleted. All snapshots are kept if 0.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	Retention int32 `json:"retention,omitempty"`
+	// RevertTo reverts all replicas in the snapshot with this name in status
+	// once, replicas created since are reported in the status message. Clear
+	// it to revert to the same snapshot again.
+	// +kubebuilder:validation:Optional
+	RevertTo string `json:"revertTo,omitempty"`
+}
+
+// VmGroupSnapshotStatus defines the observed state of VmGroupSnapshot
+type VmGroupSnapshotStatus struct {
+	// +kubebuilder:validation:Optional
+	Phase StatusPhase `json:"phase"`
+	// Snapshots taken, oldest first
+	Snapshots        []GroupSnapshot `json:"snapshots,omitempty"`
+	LastScheduleTime *metav1.Time    `json:"lastScheduleTime,omitempty"`
+	NextScheduleTime *metav1.Time    `json:"nextScheduleTime,omitempty"`
+	// RevertedTo is the snapshot of the last revert, cleared when revertTo
+	// is cleared
+	RevertedTo  string `json:"revertedTo,omitempty"`
+	LastMessage string `json:"lastMessage"`
+}
+
+// GroupSnapshot is a snapshot taken on all replicas of a VmGroup
+type GroupSnapshot struct {
+	Name      string             `json:"name"`
+	CreatedAt metav1.Time        `json:"createdAt"`
+	VMs       []VmSnapshotStatus `json:"vms,omitempty"`
+}
+
+// VmSnapshotStatus is the snapshot status of a replica
+type VmSnapshotStatus struct {
+	VM      string `json:"vm"`
+	Ready   bool   `json:"ready"`
+	Message string `json:"message,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:validation:Optional
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:shortName={"vgs"}
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="VmGroup",type=string,JSONPath=`.spec.vmGroupRef.name`
+// +kubebuilder:printcolumn:name="Schedule",type=string,JSONPath=`.spec.schedule`
+// +kubebuilder:printcolumn:name="Last_Schedule",type=date,JSONPath=`.status.lastScheduleTime`
+// +kubebuilder:printcolumn:name="Last_Message",type=string,JSONPath=`.status.lastMessage`
+
+// VmGroupSnapshot is the Schema for the vmgroupsnapshots API
+type VmGroupSnapshot struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   VmGroupSnapshotSpec   `json:"spec,omitempty"`
+	Status VmGroupSnapshotStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// VmGroupSnapshotList contains a list of VmGroupSnapshot
+type VmGroupSnapshotList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VmGroupSnapshot `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&VmGroupSnapshot{}, &VmGroupSnapshotList{})
+}
@@ -0,0 +1,105 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// VmNamespaceConfigSpec defines the desired state of VmNamespaceConfig
+type VmNamespaceConfigSpec struct {
+	// Folder is the name of the namespace folder in the operator VM folder
+	// the group folders of all VmGroups in the namespace are created in,
+	// defaults to the namespace name. It cannot be changed while VmGroups exist.
+	// +kubebuilder:validation:Optional
+	Folder string `json:"folder,omitempty"`
+	// ResourcePool configures the resource pool named like the namespace all
+	// replicas in the namespace are placed in
+	// +kubebuilder:validation:Optional
+	ResourcePool *NamespaceResourcePool `json:"resourcePool,omitempty"`
+	// AllowedTemplates are the templates VmGroups in the namespace may be
+	// created from: template names or inventory paths, or "<library>/<item>"
+	// for content library items. Entries may be glob patterns, e.g.
+	// "ubuntu-*". All templates are allowed if empty.
+	// +kubebuilder:validation:Optional
+	AllowedTemplates []string `json:"allowedTemplates,omitempty"`
+	// AllowedNetworks are the networks VmGroups in the namespace may connect
+	// replicas to. Entries may be glob patterns. If set, VmGroups must set
+	// spec.network.
+	// +kubebuilder:validation:Optional
+	AllowedNetworks []string `json:"allowedNetworks,omitempty"`
+}
+
+// NamespaceResourcePool defines the resource pool of a namespace
+type NamespaceResourcePool struct {
+	// Parent is the inventory path of the resource pool the namespace pool is
+	// created in, defaults to the operator default resource pool
+	// +kubebuilder:validation:Optional
+	Parent string `json:"parent,omitempty"`
+	// CPULimit in MHz, unlimited if not set
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	CPULimit *int64 `json:"cpuLimit,omitempty"`
+	// MemoryLimit in MB, unlimited if not set
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	MemoryLimit *int64 `json:"memoryLimit,omitempty"`
+}
+
+// VmNamespaceConfigStatus defines the observed state of VmNamespaceConfig
+type VmNamespaceConfigStatus struct {
+	// +kubebuilder:validation:Optional
+	Phase StatusPhase `json:"phase"`
+	// Folder is the inventory path of the namespace folder
+	Folder string `json:"folder,omitempty"`
+	// ResourcePool is the inventory path of the namespace resource pool
+	ResourcePool string `json:"resourcePool,omitempty"`
+	LastMessage  string `json:"lastMessage"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:validation:Optional
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster,shortName={"vnc"}
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Folder",type=string,JSONPath=`.status.folder`
+// +kubebuilder:printcolumn:name="Resource_Pool",type=string,JSONPath=`.status.resourcePool`
+// +kubebuilder:printcolumn:name="Last_Message",type=string,JSONPath=`.status.lastMessage`
+
+// VmNamespaceConfig is the Schema for the vmnamespaceconfigs API. It isolates
+// the VmGroups of the namespace with the same name in vCenter. It is cluster
+// scoped, so it cannot be changed by users of the namespace.
+type VmNamespaceConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   VmNamespaceConfigSpec   `json:"spec,omitempty"`
+	Status VmNamespaceConfigStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// VmNamespaceConfigList contains a list of VmNamespaceConfig
+type VmNamespaceConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VmNamespaceConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&VmNamespaceConfig{}, &VmNamespaceConfigList{})
+}
@@ -0,0 +1,92 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// VmQuotaSpec defines the desired state of VmQuota
+type VmQuotaSpec struct {
+	// Hard limits the total resources of all VmGroups in the namespace
+	// +kubebuilder:validation:Required
+	Hard VmQuotaResources `json:"hard"`
+}
+
+// VmQuotaResources are the resources of VmGroups in a namespace. Unset
+// resources are not limited.
+type VmQuotaResources struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	Replicas *int32 `json:"replicas,omitempty"`
+	// CPU is the number of vCPUs
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	CPU *int32 `json:"cpu,omitempty"`
+	// Memory in GB
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	Memory *int32 `json:"memory,omitempty"`
+	// Disk is the provisioned disk capacity of the replicas, e.g. "500Gi"
+	// +kubebuilder:validation:Optional
+	Disk *resource.Quantity `json:"disk,omitempty"`
+}
+
+// VmQuotaStatus defines the observed state of VmQuota
+type VmQuotaStatus struct {
+	// +kubebuilder:validation:Optional
+	Phase StatusPhase `json:"phase"`
+	// Used are the resources of all VmGroups in the namespace
+	Used        VmQuotaResources `json:"used,omitempty"`
+	LastMessage string           `json:"lastMessage"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:validation:Optional
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=vmquotas,shortName={"vq"}
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Replicas",type=integer,JSONPath=`.status.used.replicas`
+// +kubebuilder:printcolumn:name="CPU",type=integer,JSONPath=`.status.used.cpu`
+// +kubebuilder:printcolumn:name="Memory",type=integer,JSONPath=`.status.used.memory`
+// +kubebuilder:printcolumn:name="Disk",type=string,JSONPath=`.status.used.disk`
+// +kubebuilder:printcolumn:name="Last_Message",type=string,JSONPath=`.status.lastMessage`
+
+// VmQuota is the Schema for the vmquotas API. VmGroups exceeding a VmQuota
+// in their namespace are rejected on admission, scale-ups bypassing admission
+// (e.g. the scale subresource) are capped when reconciled.
+type VmQuota struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   VmQuotaSpec   `json:"spec,omitempty"`
+	Status VmQuotaStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// VmQuotaList contains a list of VmQuota
+type VmQuotaList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VmQuota `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&VmQuota{}, &VmQuotaList{})
+}
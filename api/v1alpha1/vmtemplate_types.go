@@ -0,0 +1,97 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// VmTemplateSpec defines the desired state of VmTemplate
+type VmTemplateSpec struct {
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinItems=1
+	Versions []VmTemplateVersion `json:"versions"`
+	// Promoted is the name of the version VmGroups referencing this template
+	// are rolled out to
+	// +kubebuilder:validation:Required
+	Promoted string `json:"promoted"`
+}
+
+// VmTemplateVersion is a version of a template in vCenter. Either template or
+// contentLibrary must be set.
+type VmTemplateVersion struct {
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+	// Template is the name or inventory path of a template VM
+	// +kubebuilder:validation:Optional
+	Template string `json:"template,omitempty"`
+	// +kubebuilder:validation:Optional
+	ContentLibrary *ContentLibraryItem `json:"contentLibrary,omitempty"`
+}
+
+// VmTemplateStatus defines the observed state of VmTemplate
+type VmTemplateStatus struct {
+	// +kubebuilder:validation:Optional
+	Phase StatusPhase `json:"phase"`
+	// PromotedVersion is the promoted version once it was validated
+	PromotedVersion string `json:"promotedVersion,omitempty"`
+	// Checksum of the promoted version
+	Checksum    string                    `json:"checksum,omitempty"`
+	Versions    []VmTemplateVersionStatus `json:"versions,omitempty"`
+	LastMessage string                    `json:"lastMessage"`
+}
+
+// VmTemplateVersionStatus is the observed state of a template version
+type VmTemplateVersionStatus struct {
+	Name string `json:"name"`
+	// Checksum identifies the content of the version in vCenter and changes
+	// when the underlying template is modified
+	Checksum string `json:"checksum,omitempty"`
+	Ready    bool   `json:"ready"`
+	Message  string `json:"message,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:validation:Optional
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:shortName={"vt"}
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Promoted",type=string,JSONPath=`.spec.promoted`
+// +kubebuilder:printcolumn:name="Active",type=string,JSONPath=`.status.promotedVersion`
+// +kubebuilder:printcolumn:name="Last_Message",type=string,JSONPath=`.status.lastMessage`
+
+// VmTemplate is the Schema for the vmtemplates API
+type VmTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   VmTemplateSpec   `json:"spec,omitempty"`
+	Status VmTemplateStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// VmTemplateList contains a list of VmTemplate
+type VmTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VmTemplate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&VmTemplate{}, &VmTemplateList{})
+}
@@ -21,15 +21,245 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/api/core/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Archive) DeepCopyInto(out *Archive) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Archive.
+func (in *Archive) DeepCopy() *Archive {
+	if in == nil {
+		return nil
+	}
+	out := new(Archive)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Condition) DeepCopyInto(out *Condition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Condition.
+func (in *Condition) DeepCopy() *Condition {
+	if in == nil {
+		return nil
+	}
+	out := new(Condition)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ContentLibraryItem) DeepCopyInto(out *ContentLibraryItem) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ContentLibraryItem.
+func (in *ContentLibraryItem) DeepCopy() *ContentLibraryItem {
+	if in == nil {
+		return nil
+	}
+	out := new(ContentLibraryItem)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GroupSnapshot) DeepCopyInto(out *GroupSnapshot) {
+	*out = *in
+	in.CreatedAt.DeepCopyInto(&out.CreatedAt)
+	if in.VMs != nil {
+		in, out := &in.VMs, &out.VMs
+		*out = make([]VmSnapshotStatus, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GroupSnapshot.
+func (in *GroupSnapshot) DeepCopy() *GroupSnapshot {
+	if in == nil {
+		return nil
+	}
+	out := new(GroupSnapshot)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespaceResourcePool) DeepCopyInto(out *NamespaceResourcePool) {
+	*out = *in
+	if in.CPULimit != nil {
+		in, out := &in.CPULimit, &out.CPULimit
+		*out = new(int64)
+		**out = **in
+	}
+	if in.MemoryLimit != nil {
+		in, out := &in.MemoryLimit, &out.MemoryLimit
+		*out = new(int64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespaceResourcePool.
+func (in *NamespaceResourcePool) DeepCopy() *NamespaceResourcePool {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespaceResourcePool)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Placement) DeepCopyInto(out *Placement) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Placement.
+func (in *Placement) DeepCopy() *Placement {
+	if in == nil {
+		return nil
+	}
+	out := new(Placement)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Recommendation) DeepCopyInto(out *Recommendation) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Recommendation.
+func (in *Recommendation) DeepCopy() *Recommendation {
+	if in == nil {
+		return nil
+	}
+	out := new(Recommendation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScheduleAction) DeepCopyInto(out *ScheduleAction) {
+	*out = *in
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScheduleAction.
+func (in *ScheduleAction) DeepCopy() *ScheduleAction {
+	if in == nil {
+		return nil
+	}
+	out := new(ScheduleAction)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScheduledActionStatus) DeepCopyInto(out *ScheduledActionStatus) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScheduledActionStatus.
+func (in *ScheduledActionStatus) DeepCopy() *ScheduledActionStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ScheduledActionStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServicePort) DeepCopyInto(out *ServicePort) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServicePort.
+func (in *ServicePort) DeepCopy() *ServicePort {
+	if in == nil {
+		return nil
+	}
+	out := new(ServicePort)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceSpec) DeepCopyInto(out *ServiceSpec) {
+	*out = *in
+	if in.Ports != nil {
+		in, out := &in.Ports, &out.Ports
+		*out = make([]ServicePort, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceSpec.
+func (in *ServiceSpec) DeepCopy() *ServiceSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Tag) DeepCopyInto(out *Tag) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Tag.
+func (in *Tag) DeepCopy() *Tag {
+	if in == nil {
+		return nil
+	}
+	out := new(Tag)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TopologySpread) DeepCopyInto(out *TopologySpread) {
+	*out = *in
+	if in.Zones != nil {
+		in, out := &in.Zones, &out.Zones
+		*out = make([]Zone, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TopologySpread.
+func (in *TopologySpread) DeepCopy() *TopologySpread {
+	if in == nil {
+		return nil
+	}
+	out := new(TopologySpread)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VmGroup) DeepCopyInto(out *VmGroup) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
@@ -52,31 +282,58 @@ func (in *VmGroup) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *VmGroupList) DeepCopyInto(out *VmGroupList) {
+func (in *VmGroupAutoscaler) DeepCopyInto(out *VmGroupAutoscaler) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmGroupAutoscaler.
+func (in *VmGroupAutoscaler) DeepCopy() *VmGroupAutoscaler {
+	if in == nil {
+		return nil
+	}
+	out := new(VmGroupAutoscaler)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VmGroupAutoscaler) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VmGroupAutoscalerList) DeepCopyInto(out *VmGroupAutoscalerList) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ListMeta.DeepCopyInto(&out.ListMeta)
 	if in.Items != nil {
 		in, out := &in.Items, &out.Items
-		*out = make([]VmGroup, len(*in))
+		*out = make([]VmGroupAutoscaler, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmGroupList.
-func (in *VmGroupList) DeepCopy() *VmGroupList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmGroupAutoscalerList.
+func (in *VmGroupAutoscalerList) DeepCopy() *VmGroupAutoscalerList {
 	if in == nil {
 		return nil
 	}
-	out := new(VmGroupList)
+	out := new(VmGroupAutoscalerList)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *VmGroupList) DeepCopyObject() runtime.Object {
+func (in *VmGroupAutoscalerList) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -84,36 +341,810 @@ func (in *VmGroupList) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *VmGroupSpec) DeepCopyInto(out *VmGroupSpec) {
+func (in *VmGroupAutoscalerSpec) DeepCopyInto(out *VmGroupAutoscalerSpec) {
 	*out = *in
+	out.ScaleTargetRef = in.ScaleTargetRef
+	if in.MinReplicas != nil {
+		in, out := &in.MinReplicas, &out.MinReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TargetCPUUtilization != nil {
+		in, out := &in.TargetCPUUtilization, &out.TargetCPUUtilization
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TargetMemoryUtilization != nil {
+		in, out := &in.TargetMemoryUtilization, &out.TargetMemoryUtilization
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ScaleUpStabilizationSeconds != nil {
+		in, out := &in.ScaleUpStabilizationSeconds, &out.ScaleUpStabilizationSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ScaleDownStabilizationSeconds != nil {
+		in, out := &in.ScaleDownStabilizationSeconds, &out.ScaleDownStabilizationSeconds
+		*out = new(int32)
+		**out = **in
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmGroupSpec.
-func (in *VmGroupSpec) DeepCopy() *VmGroupSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmGroupAutoscalerSpec.
+func (in *VmGroupAutoscalerSpec) DeepCopy() *VmGroupAutoscalerSpec {
 	if in == nil {
 		return nil
 	}
-	out := new(VmGroupSpec)
+	out := new(VmGroupAutoscalerSpec)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *VmGroupStatus) DeepCopyInto(out *VmGroupStatus) {
+func (in *VmGroupAutoscalerStatus) DeepCopyInto(out *VmGroupAutoscalerStatus) {
 	*out = *in
-	if in.CurrentReplicas != nil {
-		in, out := &in.CurrentReplicas, &out.CurrentReplicas
+	if in.CurrentCPUUtilization != nil {
+		in, out := &in.CurrentCPUUtilization, &out.CurrentCPUUtilization
+		*out = new(int32)
+		**out = **in
+	}
+	if in.CurrentMemoryUtilization != nil {
+		in, out := &in.CurrentMemoryUtilization, &out.CurrentMemoryUtilization
 		*out = new(int32)
 		**out = **in
 	}
+	if in.LastScaleTime != nil {
+		in, out := &in.LastScaleTime, &out.LastScaleTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Recommendations != nil {
+		in, out := &in.Recommendations, &out.Recommendations
+		*out = make([]Recommendation, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmGroupStatus.
-func (in *VmGroupStatus) DeepCopy() *VmGroupStatus {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmGroupAutoscalerStatus.
+func (in *VmGroupAutoscalerStatus) DeepCopy() *VmGroupAutoscalerStatus {
 	if in == nil {
 		return nil
 	}
-	out := new(VmGroupStatus)
+	out := new(VmGroupAutoscalerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VmGroupList) DeepCopyInto(out *VmGroupList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]VmGroup, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmGroupList.
+func (in *VmGroupList) DeepCopy() *VmGroupList {
+	if in == nil {
+		return nil
+	}
+	out := new(VmGroupList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VmGroupList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VmGroupSchedule) DeepCopyInto(out *VmGroupSchedule) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmGroupSchedule.
+func (in *VmGroupSchedule) DeepCopy() *VmGroupSchedule {
+	if in == nil {
+		return nil
+	}
+	out := new(VmGroupSchedule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VmGroupSchedule) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VmGroupScheduleList) DeepCopyInto(out *VmGroupScheduleList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]VmGroupSchedule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmGroupScheduleList.
+func (in *VmGroupScheduleList) DeepCopy() *VmGroupScheduleList {
+	if in == nil {
+		return nil
+	}
+	out := new(VmGroupScheduleList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VmGroupScheduleList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VmGroupScheduleSpec) DeepCopyInto(out *VmGroupScheduleSpec) {
+	*out = *in
+	out.VmGroupRef = in.VmGroupRef
+	if in.Actions != nil {
+		in, out := &in.Actions, &out.Actions
+		*out = make([]ScheduleAction, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmGroupScheduleSpec.
+func (in *VmGroupScheduleSpec) DeepCopy() *VmGroupScheduleSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VmGroupScheduleSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VmGroupScheduleStatus) DeepCopyInto(out *VmGroupScheduleStatus) {
+	*out = *in
+	if in.LastAction != nil {
+		in, out := &in.LastAction, &out.LastAction
+		*out = new(ScheduledActionStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NextAction != nil {
+		in, out := &in.NextAction, &out.NextAction
+		*out = new(ScheduledActionStatus)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmGroupScheduleStatus.
+func (in *VmGroupScheduleStatus) DeepCopy() *VmGroupScheduleStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VmGroupScheduleStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VmGroupSnapshot) DeepCopyInto(out *VmGroupSnapshot) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmGroupSnapshot.
+func (in *VmGroupSnapshot) DeepCopy() *VmGroupSnapshot {
+	if in == nil {
+		return nil
+	}
+	out := new(VmGroupSnapshot)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VmGroupSnapshot) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VmGroupSnapshotList) DeepCopyInto(out *VmGroupSnapshotList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]VmGroupSnapshot, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmGroupSnapshotList.
+func (in *VmGroupSnapshotList) DeepCopy() *VmGroupSnapshotList {
+	if in == nil {
+		return nil
+	}
+	out := new(VmGroupSnapshotList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VmGroupSnapshotList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VmGroupSnapshotSpec) DeepCopyInto(out *VmGroupSnapshotSpec) {
+	*out = *in
+	out.VmGroupRef = in.VmGroupRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmGroupSnapshotSpec.
+func (in *VmGroupSnapshotSpec) DeepCopy() *VmGroupSnapshotSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VmGroupSnapshotSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VmGroupSnapshotStatus) DeepCopyInto(out *VmGroupSnapshotStatus) {
+	*out = *in
+	if in.Snapshots != nil {
+		in, out := &in.Snapshots, &out.Snapshots
+		*out = make([]GroupSnapshot, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.LastScheduleTime != nil {
+		in, out := &in.LastScheduleTime, &out.LastScheduleTime
+		*out = (*in).DeepCopy()
+	}
+	if in.NextScheduleTime != nil {
+		in, out := &in.NextScheduleTime, &out.NextScheduleTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmGroupSnapshotStatus.
+func (in *VmGroupSnapshotStatus) DeepCopy() *VmGroupSnapshotStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VmGroupSnapshotStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VmGroupSpec) DeepCopyInto(out *VmGroupSpec) {
+	*out = *in
+	if in.ContentLibrary != nil {
+		in, out := &in.ContentLibrary, &out.ContentLibrary
+		*out = new(ContentLibraryItem)
+		**out = **in
+	}
+	if in.TemplateRef != nil {
+		in, out := &in.TemplateRef, &out.TemplateRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+	if in.Placement != nil {
+		in, out := &in.Placement, &out.Placement
+		*out = new(Placement)
+		**out = **in
+	}
+	if in.TopologySpread != nil {
+		in, out := &in.TopologySpread, &out.TopologySpread
+		*out = new(TopologySpread)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Tags != nil {
+		in, out := &in.Tags, &out.Tags
+		*out = make([]Tag, len(*in))
+		copy(*out, *in)
+	}
+	if in.Archive != nil {
+		in, out := &in.Archive, &out.Archive
+		*out = new(Archive)
+		**out = **in
+	}
+	if in.Service != nil {
+		in, out := &in.Service, &out.Service
+		*out = new(ServiceSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmGroupSpec.
+func (in *VmGroupSpec) DeepCopy() *VmGroupSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VmGroupSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VmGroupStatus) DeepCopyInto(out *VmGroupStatus) {
+	*out = *in
+	if in.CurrentReplicas != nil {
+		in, out := &in.CurrentReplicas, &out.CurrentReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Tags != nil {
+		in, out := &in.Tags, &out.Tags
+		*out = make([]Tag, len(*in))
+		copy(*out, *in)
+	}
+	if in.IgnoredVMs != nil {
+		in, out := &in.IgnoredVMs, &out.IgnoredVMs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ReplicaDisk != nil {
+		in, out := &in.ReplicaDisk, &out.ReplicaDisk
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmGroupStatus.
+func (in *VmGroupStatus) DeepCopy() *VmGroupStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VmGroupStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VmNamespaceConfig) DeepCopyInto(out *VmNamespaceConfig) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	out.Status = in.Status
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmNamespaceConfig.
+func (in *VmNamespaceConfig) DeepCopy() *VmNamespaceConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(VmNamespaceConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VmNamespaceConfig) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VmNamespaceConfigList) DeepCopyInto(out *VmNamespaceConfigList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]VmNamespaceConfig, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmNamespaceConfigList.
+func (in *VmNamespaceConfigList) DeepCopy() *VmNamespaceConfigList {
+	if in == nil {
+		return nil
+	}
+	out := new(VmNamespaceConfigList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VmNamespaceConfigList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VmNamespaceConfigSpec) DeepCopyInto(out *VmNamespaceConfigSpec) {
+	*out = *in
+	if in.ResourcePool != nil {
+		in, out := &in.ResourcePool, &out.ResourcePool
+		*out = new(NamespaceResourcePool)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AllowedTemplates != nil {
+		in, out := &in.AllowedTemplates, &out.AllowedTemplates
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedNetworks != nil {
+		in, out := &in.AllowedNetworks, &out.AllowedNetworks
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmNamespaceConfigSpec.
+func (in *VmNamespaceConfigSpec) DeepCopy() *VmNamespaceConfigSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VmNamespaceConfigSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VmNamespaceConfigStatus) DeepCopyInto(out *VmNamespaceConfigStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmNamespaceConfigStatus.
+func (in *VmNamespaceConfigStatus) DeepCopy() *VmNamespaceConfigStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VmNamespaceConfigStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VmQuota) DeepCopyInto(out *VmQuota) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmQuota.
+func (in *VmQuota) DeepCopy() *VmQuota {
+	if in == nil {
+		return nil
+	}
+	out := new(VmQuota)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VmQuota) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VmQuotaList) DeepCopyInto(out *VmQuotaList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]VmQuota, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmQuotaList.
+func (in *VmQuotaList) DeepCopy() *VmQuotaList {
+	if in == nil {
+		return nil
+	}
+	out := new(VmQuotaList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VmQuotaList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VmQuotaResources) DeepCopyInto(out *VmQuotaResources) {
+	*out = *in
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.CPU != nil {
+		in, out := &in.CPU, &out.CPU
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Memory != nil {
+		in, out := &in.Memory, &out.Memory
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Disk != nil {
+		in, out := &in.Disk, &out.Disk
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmQuotaResources.
+func (in *VmQuotaResources) DeepCopy() *VmQuotaResources {
+	if in == nil {
+		return nil
+	}
+	out := new(VmQuotaResources)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VmQuotaSpec) DeepCopyInto(out *VmQuotaSpec) {
+	*out = *in
+	in.Hard.DeepCopyInto(&out.Hard)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmQuotaSpec.
+func (in *VmQuotaSpec) DeepCopy() *VmQuotaSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VmQuotaSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VmQuotaStatus) DeepCopyInto(out *VmQuotaStatus) {
+	*out = *in
+	in.Used.DeepCopyInto(&out.Used)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmQuotaStatus.
+func (in *VmQuotaStatus) DeepCopy() *VmQuotaStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VmQuotaStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VmSnapshotStatus) DeepCopyInto(out *VmSnapshotStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmSnapshotStatus.
+func (in *VmSnapshotStatus) DeepCopy() *VmSnapshotStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VmSnapshotStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VmTemplate) DeepCopyInto(out *VmTemplate) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmTemplate.
+func (in *VmTemplate) DeepCopy() *VmTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(VmTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VmTemplate) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VmTemplateList) DeepCopyInto(out *VmTemplateList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]VmTemplate, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmTemplateList.
+func (in *VmTemplateList) DeepCopy() *VmTemplateList {
+	if in == nil {
+		return nil
+	}
+	out := new(VmTemplateList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VmTemplateList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VmTemplateSpec) DeepCopyInto(out *VmTemplateSpec) {
+	*out = *in
+	if in.Versions != nil {
+		in, out := &in.Versions, &out.Versions
+		*out = make([]VmTemplateVersion, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmTemplateSpec.
+func (in *VmTemplateSpec) DeepCopy() *VmTemplateSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VmTemplateSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VmTemplateStatus) DeepCopyInto(out *VmTemplateStatus) {
+	*out = *in
+	if in.Versions != nil {
+		in, out := &in.Versions, &out.Versions
+		*out = make([]VmTemplateVersionStatus, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmTemplateStatus.
+func (in *VmTemplateStatus) DeepCopy() *VmTemplateStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VmTemplateStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VmTemplateVersion) DeepCopyInto(out *VmTemplateVersion) {
+	*out = *in
+	if in.ContentLibrary != nil {
+		in, out := &in.ContentLibrary, &out.ContentLibrary
+		*out = new(ContentLibraryItem)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmTemplateVersion.
+func (in *VmTemplateVersion) DeepCopy() *VmTemplateVersion {
+	if in == nil {
+		return nil
+	}
+	out := new(VmTemplateVersion)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VmTemplateVersionStatus) DeepCopyInto(out *VmTemplateVersionStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VmTemplateVersionStatus.
+func (in *VmTemplateVersionStatus) DeepCopy() *VmTemplateVersionStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VmTemplateVersionStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Zone) DeepCopyInto(out *Zone) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Zone.
+func (in *Zone) DeepCopy() *Zone {
+	if in == nil {
+		return nil
+	}
+	out := new(Zone)
 	in.DeepCopyInto(out)
 	return out
 }
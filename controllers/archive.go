@@ -0,0 +1,300 @@
+package controllers
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/ovf"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+
+	"codeconnect/operator/api/v1alpha1"
+)
+
+const (
+	// archives are named <replica><archiveSuffix><timestamp>
+	archiveSuffix          = "-archived-"
+	archiveTimestampFormat = "20060102150405"
+	archiveSnapshot        = "vm-operator-archive"
+)
+
+func archiveName(vm *object.VirtualMachine) string {
+	return vm.Name() + archiveSuffix + time.Now().UTC().Format(archiveTimestampFormat)
+}
+
+// archiveTimestamp returns the timestamp of an archive name, used for sorting
+func archiveTimestamp(name string) string {
+	i := strings.LastIndex(name, archiveSuffix)
+	if i < 0 {
+		return ""
+	}
+	return name[i+len(archiveSuffix):]
+}
+
+// archiveVM keeps a recoverable copy of vm before it is deleted. Archives are
+// stored per VmGroup in a subfolder (directory for OVF) named group. Returns
+// true if vm itself was kept as archive and must not be deleted.
+func archiveVM(ctx context.Context, finder *find.Finder, archive *v1alpha1.Archive, group string, vm *object.VirtualMachine) (kept bool, err error) {
+	ctx, span := startSpan(ctx, "archiveVM", vmKey.String(vm.Name()))
+	defer func() { endSpan(span, err) }()
+
+	name := archiveName(vm)
+
+	if archive.Mode == v1alpha1.OVFArchiveMode {
+		if archive.Path == "" {
+			return false, errors.New("archive path must be set for ovf archives")
+		}
+
+		dir := filepath.Join(archive.Path, group)
+		if err = exportOVF(ctx, vm, filepath.Join(dir, name), name); err != nil {
+			return false, err
+		}
+		return false, pruneOVFArchives(dir, archive.Retention)
+	}
+
+	if archive.Folder == "" {
+		return false, errors.Errorf("archive folder must be set for %s archives", archive.Mode)
+	}
+
+	folder, err := getArchiveFolder(ctx, finder, archive.Folder, group)
+	if err != nil {
+		return false, err
+	}
+
+	switch archive.Mode {
+	case v1alpha1.TemplateArchiveMode:
+		kept = true
+		err = archiveAsTemplate(ctx, vm, folder, name)
+	case v1alpha1.CloneArchiveMode:
+		err = archiveAsClone(ctx, vm, folder, name)
+	default:
+		err = errors.Errorf("unsupported archive mode %q", archive.Mode)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return kept, pruneArchives(ctx, finder, folder, archive.Retention)
+}
+
+// getArchiveFolder returns the archive folder of group, creating it if absent
+func getArchiveFolder(ctx context.Context, finder *find.Finder, parent, group string) (*object.Folder, error) {
+	var nfe *find.NotFoundError
+
+	folder, err := getVMGroup(ctx, finder, parent, group)
+	if err == nil {
+		return folder, nil
+	}
+
+	if !errors.As(err, &nfe) {
+		return nil, errors.Wrap(err, "could not get archive folder")
+	}
+
+	folder, err = createVMGroup(ctx, finder, parent, group)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create archive folder")
+	}
+	return folder, nil
+}
+
+// archiveAsTemplate snapshots vm and moves it to folder as template. It is
+// marked as template last so a failed rename or move never leaves a template
+// in the group folder.
+func archiveAsTemplate(ctx context.Context, vm *object.VirtualMachine, folder *object.Folder, name string) error {
+	if err := powerOffVM(ctx, vm); err != nil {
+		return errors.Wrapf(err, "could not power off vm %q", vm.Name())
+	}
+
+	task, err := vm.CreateSnapshot(ctx, archiveSnapshot, "created by vm-operator before deletion", false, false)
+	if err != nil {
+		return errors.Wrap(err, "could not initiate snapshot task")
+	}
+	if err = waitTask(ctx, task); err != nil {
+		return errors.Wrapf(err, "could not snapshot vm %q", vm.Name())
+	}
+
+	replica := vm.Name()
+	if err = renameVM(ctx, vm, name); err != nil {
+		return err
+	}
+
+	task, err = folder.MoveInto(ctx, []types.ManagedObjectReference{vm.Reference()})
+	if err == nil {
+		err = waitTask(ctx, task)
+	}
+	if err != nil {
+		// the replica stays in the group folder under its name and is
+		// archived again on retry, ctx might be done already
+		rctx, cancel := context.WithTimeout(context.Background(), cancelTaskTimeout)
+		defer cancel()
+		if rerr := renameVM(rctx, vm, replica); rerr != nil {
+			return errors.Wrapf(err, "could not move archive %q, could not undo rename: %v", name, rerr)
+		}
+		return errors.Wrapf(err, "could not move archive %q", name)
+	}
+
+	return errors.Wrapf(vm.MarkAsTemplate(ctx), "could not mark archive %q as template", name)
+}
+
+// renameVM renames vm to name
+func renameVM(ctx context.Context, vm *object.VirtualMachine, name string) error {
+	task, err := vm.Rename(ctx, name)
+	if err != nil {
+		return errors.Wrap(err, "could not initiate rename task")
+	}
+	return errors.Wrapf(waitTask(ctx, task), "could not rename vm %q to %q", vm.Name(), name)
+}
+
+// archiveAsClone clones vm powered off to folder
+func archiveAsClone(ctx context.Context, vm *object.VirtualMachine, folder *object.Folder, name string) error {
+	task, err := vm.Clone(ctx, folder, name, types.VirtualMachineCloneSpec{
+		Location: types.VirtualMachineRelocateSpec{},
+	})
+	if err != nil {
+		return errors.Wrap(err, "could not initiate archive clone task")
+	}
+	return errors.Wrapf(waitTask(ctx, task), "could not clone vm %q to archive", vm.Name())
+}
+
+// exportOVF exports vm to an OVF in dir. The vm is powered off for the export.
+// The export lease is aborted if the export fails.
+func exportOVF(ctx context.Context, vm *object.VirtualMachine, dir, name string) error {
+	if err := powerOffVM(ctx, vm); err != nil {
+		return errors.Wrapf(err, "could not power off vm %q", vm.Name())
+	}
+
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return errors.Wrap(err, "could not create archive directory")
+	}
+
+	lease, err := vm.Export(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "could not export vm %q", vm.Name())
+	}
+
+	completed := false
+	defer func() {
+		if completed {
+			return
+		}
+		// an open lease blocks changes to vm until it times out, ctx might be
+		// done already
+		actx, cancel := context.WithTimeout(context.Background(), cancelTaskTimeout)
+		defer cancel()
+		_ = lease.Abort(actx, nil)
+	}()
+
+	info, err := lease.Wait(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "could not get export lease")
+	}
+
+	u := lease.StartUpdater(ctx, info)
+	defer u.Done()
+
+	cdp := types.OvfCreateDescriptorParams{
+		Name: name,
+	}
+
+	for _, i := range info.Items {
+		// disks only, e.g. no ISOs
+		if filepath.Ext(i.Path) != ".vmdk" {
+			continue
+		}
+
+		if err = lease.DownloadFile(ctx, filepath.Join(dir, i.Path), i, soap.DefaultDownload); err != nil {
+			return errors.Wrapf(err, "could not download %q", i.Path)
+		}
+		cdp.OvfFiles = append(cdp.OvfFiles, i.File())
+	}
+
+	if err = lease.Complete(ctx); err != nil {
+		return errors.Wrap(err, "could not complete export lease")
+	}
+	completed = true
+
+	desc, err := ovf.NewManager(vm.Client()).CreateDescriptor(ctx, vm, cdp)
+	if err != nil {
+		return errors.Wrap(err, "could not create OVF descriptor")
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, name+".ovf"), []byte(desc.OvfDescriptor), 0640)
+	return errors.Wrap(err, "could not write OVF descriptor")
+}
+
+// pruneArchives deletes all but the newest retention archives in folder. A
+// retention of 0 keeps all archives.
+func pruneArchives(ctx context.Context, finder *find.Finder, folder *object.Folder, retention int32) error {
+	if retention == 0 {
+		return nil
+	}
+
+	archives, err := finder.VirtualMachineList(ctx, folder.InventoryPath+"/*")
+	if err != nil {
+		return errors.Wrap(err, "could not list archives")
+	}
+
+	if len(archives) <= int(retention) {
+		return nil
+	}
+
+	// newest first
+	sort.Slice(archives, func(i, j int) bool {
+		return archiveTimestamp(archives[i].Name()) > archiveTimestamp(archives[j].Name())
+	})
+
+	for _, a := range archives[retention:] {
+		task, err := a.Destroy(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "could not delete archive %q", a.Name())
+		}
+		if err = waitTask(ctx, task); err != nil {
+			return errors.Wrapf(err, "could not delete archive %q", a.Name())
+		}
+	}
+	return nil
+}
+
+// pruneOVFArchives deletes all but the newest retention OVF archives in dir. A
+// retention of 0 keeps all archives.
+func pruneOVFArchives(dir string, retention int32) error {
+	if retention == 0 {
+		return nil
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return errors.Wrap(err, "could not list archives")
+	}
+
+	var archives []string
+	for _, f := range files {
+		if f.IsDir() {
+			archives = append(archives, f.Name())
+		}
+	}
+
+	if len(archives) <= int(retention) {
+		return nil
+	}
+
+	// newest first
+	sort.Slice(archives, func(i, j int) bool {
+		return archiveTimestamp(archives[i]) > archiveTimestamp(archives[j])
+	})
+
+	for _, a := range archives[retention:] {
+		if err = os.RemoveAll(filepath.Join(dir, a)); err != nil {
+			return errors.Wrapf(err, "could not delete archive %q", a)
+		}
+	}
+	return nil
+}
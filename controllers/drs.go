@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// DRS anti-affinity rules need at least two VMs
+const minAntiAffinityVMs = 2
+
+// getAntiAffinityRuleName returns the name of the DRS rule for a VmGroup
+func getAntiAffinityRuleName(group string) string {
+	return "vm-operator-" + group
+}
+
+func getAntiAffinityRule(ctx context.Context, cluster *object.ClusterComputeResource, name string) (*types.ClusterAntiAffinityRuleSpec, error) {
+	cfg, err := cluster.Configuration(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not get configuration for cluster %q", cluster.InventoryPath)
+	}
+
+	for _, r := range cfg.Rule {
+		rule, ok := r.(*types.ClusterAntiAffinityRuleSpec)
+		if ok && rule.Name == name {
+			return rule, nil
+		}
+	}
+
+	// not found
+	return nil, nil
+}
+
+// ensureAntiAffinityRule creates or updates the DRS anti-affinity rule name
+// to contain exactly vms. The rule is removed if there are too few vms.
+func ensureAntiAffinityRule(ctx context.Context, cluster *object.ClusterComputeResource, name string, mandatory bool, vms []*object.VirtualMachine) error {
+	rule, err := getAntiAffinityRule(ctx, cluster, name)
+	if err != nil {
+		return err
+	}
+
+	if len(vms) < minAntiAffinityVMs {
+		if rule == nil {
+			return nil
+		}
+		return reconfigureRule(ctx, cluster, types.ClusterRuleSpec{
+			ArrayUpdateSpec: types.ArrayUpdateSpec{
+				Operation: types.ArrayUpdateOperationRemove,
+				RemoveKey: rule.Key,
+			},
+		})
+	}
+
+	refs := make([]types.ManagedObjectReference, len(vms))
+	for i, vm := range vms {
+		refs[i] = vm.Reference()
+	}
+
+	if rule != nil && sameRule(rule, mandatory, refs) {
+		return nil
+	}
+
+	info := &types.ClusterAntiAffinityRuleSpec{
+		ClusterRuleInfo: types.ClusterRuleInfo{
+			Name:      name,
+			Enabled:   types.NewBool(true),
+			Mandatory: types.NewBool(mandatory),
+		},
+		Vm: refs,
+	}
+
+	op := types.ArrayUpdateOperationAdd
+	if rule != nil {
+		info.Key = rule.Key
+		op = types.ArrayUpdateOperationEdit
+	}
+
+	return reconfigureRule(ctx, cluster, types.ClusterRuleSpec{
+		ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: op},
+		Info:            info,
+	})
+}
+
+// removeAntiAffinityRule deletes the DRS anti-affinity rule name if it exists
+func removeAntiAffinityRule(ctx context.Context, cluster *object.ClusterComputeResource, name string) error {
+	rule, err := getAntiAffinityRule(ctx, cluster, name)
+	if err != nil {
+		return err
+	}
+
+	if rule == nil {
+		// already deleted
+		return nil
+	}
+
+	return reconfigureRule(ctx, cluster, types.ClusterRuleSpec{
+		ArrayUpdateSpec: types.ArrayUpdateSpec{
+			Operation: types.ArrayUpdateOperationRemove,
+			RemoveKey: rule.Key,
+		},
+	})
+}
+
+func reconfigureRule(ctx context.Context, cluster *object.ClusterComputeResource, spec types.ClusterRuleSpec) error {
+	cs := &types.ClusterConfigSpecEx{
+		RulesSpec: []types.ClusterRuleSpec{spec},
+	}
+
+	task, err := cluster.Reconfigure(ctx, cs, true)
+	if err != nil {
+		return errors.Wrapf(err, "could not initiate reconfigure task for cluster %q", cluster.InventoryPath)
+	}
+
+	err = waitTask(ctx, task)
+	if err != nil {
+		return errors.Wrapf(err, "could not %s DRS rule on cluster %q", spec.Operation, cluster.InventoryPath)
+	}
+	return nil
+}
+
+func sameRule(rule *types.ClusterAntiAffinityRuleSpec, mandatory bool, refs []types.ManagedObjectReference) bool {
+	if rule.Mandatory == nil || *rule.Mandatory != mandatory {
+		return false
+	}
+
+	if len(rule.Vm) != len(refs) {
+		return false
+	}
+
+	existing := make(map[types.ManagedObjectReference]bool, len(rule.Vm))
+	for _, ref := range rule.Vm {
+		existing[ref] = true
+	}
+
+	for _, ref := range refs {
+		if !existing[ref] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,493 @@
+package controllers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/find"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	externalmetrics "k8s.io/metrics/pkg/apis/external_metrics/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	vmv1alpha1 "codeconnect/operator/api/v1alpha1"
+)
+
+// external metrics of VmGroups, the average utilization of the replicas in
+// percent
+const (
+	cpuUtilizationMetric    = "vmgroup_cpu_utilization"
+	memoryUtilizationMetric = "vmgroup_memory_utilization"
+)
+
+// vCenter is queried at most once per VmGroup within usageCacheTTL, the HPA
+// polls every 15s by default
+const usageCacheTTL = 30 * time.Second
+
+// the API server aggregation layer publishes its requestheader client CA, the
+// allowed client certificate names and the headers of the proxied user here
+const (
+	authenticationConfigMapNamespace = "kube-system"
+	authenticationConfigMapName      = "extension-apiserver-authentication"
+)
+
+var (
+	externalMetricsGroupVersion = externalmetrics.SchemeGroupVersion.String()
+	externalMetricsPath         = "/apis/" + externalMetricsGroupVersion
+)
+
+// ExternalMetricsServer serves the external.metrics.k8s.io API with the
+// utilization of VmGroup replicas from vSphere performance counters, e.g. for
+// the HPA. Metrics are selected by the VmGroup label of the scale subresource
+// selector. Only the API server aggregation layer is accepted as client, the
+// proxied user is authorized with a SubjectAccessReview per request.
+type ExternalMetricsServer struct {
+	Client client.Client
+	// APIReader reads the requestheader configuration of the aggregation
+	// layer without caching all ConfigMaps
+	APIReader client.Reader
+	Finder    *find.Finder
+	Addr      string
+	// CertDir contains tls.crt and tls.key, a self-signed certificate is
+	// generated if empty
+	CertDir string
+	// ClientCAFile verifies client certificates. The requestheader CA of the
+	// aggregation layer is used if empty.
+	ClientCAFile string
+	Log          logr.Logger
+
+	auth  *requestHeaderAuth
+	mu    sync.Mutex
+	usage map[k8stypes.NamespacedName]cachedUsage
+}
+
+// requestHeaderAuth is the requestheader configuration of the aggregation
+// layer
+type requestHeaderAuth struct {
+	clientCA      []byte
+	allowedNames  []string // any name if empty
+	userHeaders   []string
+	groupHeaders  []string
+	extraPrefixes []string
+}
+
+type cachedUsage struct {
+	*groupUsage
+	expires time.Time
+}
+
+// NeedLeaderElection returns false, metrics are served by all replicas of the
+// operator
+func (s *ExternalMetricsServer) NeedLeaderElection() bool {
+	return false
+}
+
+// Start serves the external metrics API until stop is closed
+func (s *ExternalMetricsServer) Start(stop <-chan struct{}) error {
+	auth, err := s.requestHeaderAuth()
+	if err != nil {
+		return err
+	}
+	s.auth = auth
+
+	tlsConfig, err := s.tlsConfig()
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(externalMetricsPath, s.authenticated(s.serveResources))
+	mux.HandleFunc(externalMetricsPath+"/namespaces/", s.authenticated(s.serveMetric))
+
+	srv := &http.Server{
+		Addr:      s.Addr,
+		Handler:   mux,
+		TLSConfig: tlsConfig,
+	}
+
+	go func() {
+		<-stop
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	}()
+
+	s.Log.Info("serving external metrics", "addr", s.Addr)
+	if err = srv.ListenAndServeTLS("", ""); err != http.ErrServerClosed {
+		return errors.Wrap(err, "could not serve external metrics")
+	}
+	return nil
+}
+
+func (s *ExternalMetricsServer) tlsConfig() (*tls.Config, error) {
+	var (
+		cert tls.Certificate
+		err  error
+	)
+	if s.CertDir == "" {
+		cert, err = selfSignedCertificate()
+	} else {
+		cert, err = tls.LoadX509KeyPair(filepath.Join(s.CertDir, "tls.crt"), filepath.Join(s.CertDir, "tls.key"))
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "could not load external metrics certificate")
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    x509.NewCertPool(),
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	if !config.ClientCAs.AppendCertsFromPEM(s.auth.clientCA) {
+		return nil, errors.New("no certificates found in external metrics client CA")
+	}
+	return config, nil
+}
+
+// requestHeaderAuth returns the client CA of ClientCAFile or the requestheader
+// configuration of the aggregation layer. Serving without verified clients
+// would trust the user headers of any client.
+func (s *ExternalMetricsServer) requestHeaderAuth() (*requestHeaderAuth, error) {
+	auth := &requestHeaderAuth{
+		userHeaders:   []string{"X-Remote-User"},
+		groupHeaders:  []string{"X-Remote-Group"},
+		extraPrefixes: []string{"X-Remote-Extra-"},
+	}
+
+	if s.ClientCAFile != "" {
+		ca, err := ioutil.ReadFile(s.ClientCAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not read external metrics client CA")
+		}
+		auth.clientCA = ca
+		return auth, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cm := &corev1.ConfigMap{}
+	key := client.ObjectKey{Namespace: authenticationConfigMapNamespace, Name: authenticationConfigMapName}
+	if err := s.APIReader.Get(ctx, key, cm); err != nil {
+		return nil, errors.Wrapf(err, "could not get requestheader configuration %q", key)
+	}
+
+	ca := cm.Data["requestheader-client-ca-file"]
+	if ca == "" {
+		return nil, errors.Errorf("no requestheader client CA in %q", key)
+	}
+	auth.clientCA = []byte(ca)
+
+	for name, v := range map[string]*[]string{
+		"requestheader-allowed-names":        &auth.allowedNames,
+		"requestheader-username-headers":     &auth.userHeaders,
+		"requestheader-group-headers":        &auth.groupHeaders,
+		"requestheader-extra-headers-prefix": &auth.extraPrefixes,
+	} {
+		if cm.Data[name] == "" {
+			continue
+		}
+		if err := json.Unmarshal([]byte(cm.Data[name]), v); err != nil {
+			return nil, errors.Wrapf(err, "could not parse %s in %q", name, key)
+		}
+	}
+	return auth, nil
+}
+
+// authenticated serves only requests proxied by the aggregation layer for a
+// user allowed to get the requested metric
+func (s *ExternalMetricsServer) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !s.allowedClient(req) {
+			s.writeError(w, http.StatusUnauthorized, metav1.StatusReasonUnauthorized, "client certificate not allowed")
+			return
+		}
+
+		user := firstHeader(req.Header, s.auth.userHeaders)
+		if user == "" {
+			s.writeError(w, http.StatusUnauthorized, metav1.StatusReasonUnauthorized, "no user in request headers")
+			return
+		}
+
+		// discovery is allowed for all users
+		if req.URL.Path == externalMetricsPath {
+			next(w, req)
+			return
+		}
+
+		allowed, err := s.authorize(req, user)
+		if err != nil {
+			s.Log.Error(err, "could not authorize external metrics request", "user", user)
+			s.writeError(w, http.StatusInternalServerError, metav1.StatusReasonInternalError, err.Error())
+			return
+		}
+		if !allowed {
+			s.writeError(w, http.StatusForbidden, metav1.StatusReasonForbidden, "user "+user+" cannot get "+req.URL.Path)
+			return
+		}
+		next(w, req)
+	}
+}
+
+// allowedClient returns true if the verified client certificate has one of the
+// allowed names
+func (s *ExternalMetricsServer) allowedClient(req *http.Request) bool {
+	if req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+		return false
+	}
+	if len(s.auth.allowedNames) == 0 {
+		return true
+	}
+
+	cn := req.TLS.PeerCertificates[0].Subject.CommonName
+	for _, name := range s.auth.allowedNames {
+		if name == cn {
+			return true
+		}
+	}
+	return false
+}
+
+// authorize asks the API server if user may get the metric of the request
+func (s *ExternalMetricsServer) authorize(req *http.Request, user string) (bool, error) {
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, externalMetricsPath+"/namespaces/"), "/")
+	if len(parts) != 2 {
+		// not found for all users
+		return true, nil
+	}
+
+	var groups []string
+	for _, h := range s.auth.groupHeaders {
+		groups = append(groups, req.Header[http.CanonicalHeaderKey(h)]...)
+	}
+
+	extra := make(map[string]authorizationv1.ExtraValue)
+	for h, values := range req.Header {
+		for _, prefix := range s.auth.extraPrefixes {
+			prefix = http.CanonicalHeaderKey(prefix)
+			if strings.HasPrefix(h, prefix) {
+				key := strings.ToLower(strings.TrimPrefix(h, prefix))
+				extra[key] = append(extra[key], values...)
+			}
+		}
+	}
+
+	sar := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user,
+			Groups: groups,
+			Extra:  extra,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: parts[0],
+				Verb:      "get",
+				Group:     externalmetrics.SchemeGroupVersion.Group,
+				Version:   externalmetrics.SchemeGroupVersion.Version,
+				Resource:  parts[1],
+			},
+		},
+	}
+	if err := s.Client.Create(req.Context(), sar); err != nil {
+		return false, errors.Wrap(err, "could not create SubjectAccessReview")
+	}
+	return sar.Status.Allowed, nil
+}
+
+// firstHeader returns the first value of the first set header of names
+func firstHeader(h http.Header, names []string) string {
+	for _, name := range names {
+		if v := h.Get(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// serveResources serves the discovery of the external metrics
+func (s *ExternalMetricsServer) serveResources(w http.ResponseWriter, req *http.Request) {
+	list := &metav1.APIResourceList{
+		TypeMeta:     metav1.TypeMeta{Kind: "APIResourceList", APIVersion: "v1"},
+		GroupVersion: externalMetricsGroupVersion,
+	}
+	for _, name := range []string{cpuUtilizationMetric, memoryUtilizationMetric} {
+		list.APIResources = append(list.APIResources, metav1.APIResource{
+			Name:       name,
+			Namespaced: true,
+			Kind:       "ExternalMetricValueList",
+			Verbs:      metav1.Verbs{"get"},
+		})
+	}
+	s.writeJSON(w, http.StatusOK, list)
+}
+
+// serveMetric serves /namespaces/<namespace>/<metric>?labelSelector=<selector>
+// with one value per matching VmGroup with running replicas
+func (s *ExternalMetricsServer) serveMetric(w http.ResponseWriter, req *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, externalMetricsPath+"/namespaces/"), "/")
+	if len(parts) != 2 {
+		s.writeError(w, http.StatusNotFound, metav1.StatusReasonNotFound, "not found")
+		return
+	}
+	namespace, metric := parts[0], parts[1]
+
+	if metric != cpuUtilizationMetric && metric != memoryUtilizationMetric {
+		s.writeError(w, http.StatusNotFound, metav1.StatusReasonNotFound, "metric "+metric+" not found")
+		return
+	}
+
+	selector, err := labels.Parse(req.URL.Query().Get("labelSelector"))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, metav1.StatusReasonBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), usageCacheTTL)
+	defer cancel()
+
+	var groups vmv1alpha1.VmGroupList
+	if err = s.Client.List(ctx, &groups, client.InNamespace(namespace)); err != nil {
+		s.Log.Error(err, "could not list VmGroups", "namespace", namespace)
+		s.writeError(w, http.StatusInternalServerError, metav1.StatusReasonInternalError, err.Error())
+		return
+	}
+
+	list := &externalmetrics.ExternalMetricValueList{
+		TypeMeta: metav1.TypeMeta{Kind: "ExternalMetricValueList", APIVersion: externalMetricsGroupVersion},
+	}
+	for i := range groups.Items {
+		vg := &groups.Items[i]
+		metricLabels := labels.Set{VmGroupLabel: vg.Name}
+		if !selector.Matches(metricLabels) {
+			continue
+		}
+
+		usage, err := s.getUsage(ctx, vg)
+		if err != nil {
+			// the HPA sees no value for this VmGroup, other VmGroups are served
+			s.Log.Error(err, "could not get utilization of replicas", "vmgroup", vg.Namespace+"/"+vg.Name)
+			continue
+		}
+
+		// no running replicas
+		if usage.vms == 0 {
+			continue
+		}
+
+		value := usage.cpu
+		if metric == memoryUtilizationMetric {
+			value = usage.memory
+		}
+
+		list.Items = append(list.Items, externalmetrics.ExternalMetricValue{
+			MetricName:   metric,
+			MetricLabels: metricLabels,
+			Timestamp:    metav1.Now(),
+			Value:        *resource.NewMilliQuantity(int64(value*1000), resource.DecimalSI),
+		})
+	}
+	s.writeJSON(w, http.StatusOK, list)
+}
+
+// getUsage returns the cached utilization of the replicas of vg
+func (s *ExternalMetricsServer) getUsage(ctx context.Context, vg *vmv1alpha1.VmGroup) (*groupUsage, error) {
+	key := k8stypes.NamespacedName{Namespace: vg.Namespace, Name: vg.Name}
+
+	s.mu.Lock()
+	cached, ok := s.usage[key]
+	s.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.groupUsage, nil
+	}
+
+	vms, err := getVmGroupReplicas(ctx, s.Client, s.Finder, vg)
+	if err != nil {
+		return nil, err
+	}
+
+	usage, err := getGroupUsage(ctx, vms)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.usage == nil {
+		s.usage = make(map[k8stypes.NamespacedName]cachedUsage)
+	}
+
+	// evict expired entries, e.g. of deleted VmGroups
+	now := time.Now()
+	for k, v := range s.usage {
+		if now.After(v.expires) {
+			delete(s.usage, k)
+		}
+	}
+	s.usage[key] = cachedUsage{groupUsage: usage, expires: now.Add(usageCacheTTL)}
+	return usage, nil
+}
+
+func (s *ExternalMetricsServer) writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.Log.Error(err, "could not write external metrics response")
+	}
+}
+
+func (s *ExternalMetricsServer) writeError(w http.ResponseWriter, code int, reason metav1.StatusReason, msg string) {
+	s.writeJSON(w, code, &metav1.Status{
+		TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+		Status:   metav1.StatusFailure,
+		Message:  msg,
+		Reason:   reason,
+		Code:     int32(code),
+	})
+}
+
+// selfSignedCertificate returns a certificate for APIServices with
+// insecureSkipTLSVerify
+func selfSignedCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "vm-operator-external-metrics"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRequestHeaderAuth(t *testing.T) {
+	configMap := func(data map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: authenticationConfigMapNamespace, Name: authenticationConfigMapName},
+			Data:       data,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		cm      *corev1.ConfigMap
+		want    *requestHeaderAuth
+		wantErr bool
+	}{
+		{
+			name:    "no configmap",
+			wantErr: true,
+		},
+		{
+			name:    "no client CA",
+			cm:      configMap(map[string]string{"requestheader-allowed-names": `["front-proxy-client"]`}),
+			wantErr: true,
+		},
+		{
+			name: "default headers",
+			cm:   configMap(map[string]string{"requestheader-client-ca-file": "ca"}),
+			want: &requestHeaderAuth{
+				clientCA:      []byte("ca"),
+				userHeaders:   []string{"X-Remote-User"},
+				groupHeaders:  []string{"X-Remote-Group"},
+				extraPrefixes: []string{"X-Remote-Extra-"},
+			},
+		},
+		{
+			name: "configured headers",
+			cm: configMap(map[string]string{
+				"requestheader-client-ca-file":       "ca",
+				"requestheader-allowed-names":        `["front-proxy-client"]`,
+				"requestheader-username-headers":     `["X-User"]`,
+				"requestheader-group-headers":        `["X-Group"]`,
+				"requestheader-extra-headers-prefix": `["X-Extra-"]`,
+			}),
+			want: &requestHeaderAuth{
+				clientCA:      []byte("ca"),
+				allowedNames:  []string{"front-proxy-client"},
+				userHeaders:   []string{"X-User"},
+				groupHeaders:  []string{"X-Group"},
+				extraPrefixes: []string{"X-Extra-"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := fake.NewFakeClientWithScheme(clientgoscheme.Scheme)
+			if tt.cm != nil {
+				reader = fake.NewFakeClientWithScheme(clientgoscheme.Scheme, tt.cm)
+			}
+			s := &ExternalMetricsServer{APIReader: reader}
+
+			got, err := s.requestHeaderAuth()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("requestHeaderAuth() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("requestHeaderAuth() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowedClient(t *testing.T) {
+	withCert := func(cn string) *http.Request {
+		return &http.Request{TLS: &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: cn}}},
+		}}
+	}
+
+	tests := []struct {
+		name         string
+		allowedNames []string
+		req          *http.Request
+		want         bool
+	}{
+		{
+			name: "no TLS",
+			req:  &http.Request{},
+		},
+		{
+			name: "no client certificate",
+			req:  &http.Request{TLS: &tls.ConnectionState{}},
+		},
+		{
+			name: "any name",
+			req:  withCert("client"),
+			want: true,
+		},
+		{
+			name:         "allowed name",
+			allowedNames: []string{"front-proxy-client"},
+			req:          withCert("front-proxy-client"),
+			want:         true,
+		},
+		{
+			name:         "other name",
+			allowedNames: []string{"front-proxy-client"},
+			req:          withCert("client"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &ExternalMetricsServer{auth: &requestHeaderAuth{allowedNames: tt.allowedNames}}
+			if got := s.allowedClient(tt.req); got != tt.want {
+				t.Errorf("allowedClient() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
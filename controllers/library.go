@@ -0,0 +1,169 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vapi/library"
+	"github.com/vmware/govmomi/vapi/rest"
+	"github.com/vmware/govmomi/vapi/vcenter"
+	"github.com/vmware/govmomi/vim25/types"
+
+	"codeconnect/operator/api/v1alpha1"
+)
+
+// content library item types
+const (
+	ovfItemType  = "ovf"
+	vmtxItemType = "vm-template"
+)
+
+// getLibraryItem returns the content library item referenced in the spec
+func getLibraryItem(ctx context.Context, rc *rest.Client, ref *v1alpha1.ContentLibraryItem) (*library.Item, error) {
+	m := library.NewManager(rc)
+
+	lib, err := m.GetLibraryByName(ctx, ref.Library)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not find content library %q", ref.Library)
+	}
+
+	ids, err := m.FindLibraryItems(ctx, library.FindItem{
+		LibraryID: lib.ID,
+		Name:      ref.Item,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not find item %q in content library %q", ref.Item, ref.Library)
+	}
+
+	if len(ids) == 0 {
+		return nil, errors.Errorf("item %q not found in content library %q", ref.Item, ref.Library)
+	}
+
+	return m.GetLibraryItem(ctx, ids[0])
+}
+
+// deployLibraryItem creates a replica from an OVF or VM template in a content
+// library. Replicas are always full copies, reconfigured to the CPU, memory
+// and network in spec and powered on unless the desired power state is
+// poweredOff. If the replica was deployed but could not be configured, a
+// *deployedError is returned.
+func deployLibraryItem(ctx context.Context, finder *find.Finder, rc *rest.Client, src *templateSource, name string, destination string, z *zone, host *object.HostSystem, spec v1alpha1.VmGroupSpec) error {
+	item, err := getLibraryItem(ctx, rc, src.contentLibrary)
+	if err != nil {
+		return err
+	}
+
+	folder, err := finder.Folder(ctx, destination)
+	if err != nil {
+		return errors.Wrap(err, "could not find destination folder")
+	}
+
+	var hostID, datastoreID string
+	if host != nil {
+		hostID = host.Reference().Value
+	}
+	if z.datastore != nil {
+		datastoreID = z.datastore.Reference().Value
+	}
+
+	m := vcenter.NewManager(rc)
+
+	var ref *types.ManagedObjectReference
+	switch item.Type {
+	case ovfItemType:
+		ref, err = m.DeployLibraryItem(ctx, item.ID, vcenter.Deploy{
+			DeploymentSpec: vcenter.DeploymentSpec{
+				Name:               name,
+				AcceptAllEULA:      true,
+				DefaultDatastoreID: datastoreID,
+			},
+			Target: vcenter.Target{
+				ResourcePoolID: z.pool.Reference().Value,
+				HostID:         hostID,
+				FolderID:       folder.Reference().Value,
+			},
+		})
+	case vmtxItemType:
+		deploy := vcenter.DeployTemplate{
+			Name: name,
+			Placement: &vcenter.Placement{
+				ResourcePool: z.pool.Reference().Value,
+				Host:         hostID,
+				Folder:       folder.Reference().Value,
+			},
+		}
+		if datastoreID != "" {
+			deploy.DiskStorage = &vcenter.DiskStorage{Datastore: datastoreID}
+			deploy.VMHomeStorage = &vcenter.DiskStorage{Datastore: datastoreID}
+		}
+		ref, err = m.DeployTemplateLibraryItem(ctx, item.ID, deploy)
+	default:
+		return errors.Errorf("unsupported content library item type %q", item.Type)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "could not deploy %q from content library item %q", name, item.Name)
+	}
+
+	vm := object.NewVirtualMachine(folder.Client(), *ref)
+	vm.InventoryPath = folder.InventoryPath + "/" + name
+
+	if err = configureDeployed(ctx, finder, src, vm, spec); err != nil {
+		return &deployedError{vm: vm, err: err}
+	}
+	return nil
+}
+
+// deployedError is returned if a replica was deployed from a content library
+// item but could not be configured or powered on. The replica is not marked as
+// owned and has to be deleted by the caller.
+type deployedError struct {
+	vm  *object.VirtualMachine
+	err error
+}
+
+func (e *deployedError) Error() string { return e.err.Error() }
+
+func (e *deployedError) Unwrap() error { return e.err }
+
+// configureDeployed reconfigures the deployed vm to the CPU, memory and network
+// in spec and powers it on unless the desired power state is poweredOff
+func configureDeployed(ctx context.Context, finder *find.Finder, src *templateSource, vm *object.VirtualMachine, spec v1alpha1.VmGroupSpec) error {
+	config := types.VirtualMachineConfigSpec{
+		NumCPUs:     spec.CPU,
+		MemoryMB:    int64(1024 * spec.Memory),
+		ExtraConfig: src.options(),
+	}
+
+	var err error
+	if spec.Network != "" {
+		config.DeviceChange, err = networkDeviceChange(ctx, finder, vm, spec.Network)
+		if err != nil {
+			return err
+		}
+	}
+
+	task, err := vm.Reconfigure(ctx, config)
+	if err != nil {
+		return errors.Wrap(err, "could not initiate reconfigure task")
+	}
+
+	if err = waitTask(ctx, task); err != nil {
+		return errors.Wrapf(err, "could not reconfigure %q", vm.Name())
+	}
+
+	if getPowerState(spec) == v1alpha1.PoweredOffPowerState {
+		return nil
+	}
+
+	task, err = vm.PowerOn(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not initiate power on task")
+	}
+
+	if err = waitTask(ctx, task); err != nil {
+		return errors.Wrapf(err, "could not power on %q", vm.Name())
+	}
+	return nil
+}
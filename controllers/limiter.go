@@ -1,24 +1,155 @@
 package controllers
 
-type limiter struct {
-	bucket chan struct{}
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/api/kv"
+)
+
+// DefaultConcurrency is the default max number of parallel vCenter operations
+// per operation type
+const DefaultConcurrency = 3
+
+var operationKey = kv.Key("vcenter.operation")
+
+// Limiter limits the number of parallel vCenter operations across all
+// reconciles. Each operation type has its own budget so e.g. long running
+// clones don't block power ons. Waiting operations are granted round-robin by
+// namespace so a large VmGroup can't starve VmGroups in other namespaces.
+type Limiter struct {
+	mu    sync.Mutex
+	pools map[string]*pool // by operation
 }
 
-func (l *limiter) acquire() {
-	<-l.bucket
+// pool is the budget of an operation type
+type pool struct {
+	available int
+	queues    map[string][]chan struct{} // waiters by namespace
+	order     []string                   // namespaces with waiters, round-robin
 }
 
-func (l *limiter) release() {
-	l.bucket <- struct{}{}
+// NewLimiter returns a Limiter with the given max number of parallel clone,
+// power on and destroy operations. Power offs have the same budget as power
+// ons, snapshots the same budget as clones.
+func NewLimiter(clone, powerOn, destroy int) *Limiter {
+	return &Limiter{
+		pools: map[string]*pool{
+			cloneOperation:    newPool(clone),
+			powerOnOperation:  newPool(powerOn),
+			powerOffOperation: newPool(powerOn),
+			destroyOperation:  newPool(destroy),
+			snapshotOperation: newPool(clone),
+		},
+	}
+}
+
+func newPool(concurrency int) *pool {
+	return &pool{
+		available: concurrency,
+		queues:    make(map[string][]chan struct{}),
+	}
 }
 
-func newLimiter(concurrency int) *limiter {
-	b := make(chan struct{}, concurrency)
-	// fill bucket
-	for token := 0; token < concurrency; token++ {
-		b <- struct{}{}
+// acquire blocks until op can be executed for namespace or ctx is done
+func (l *Limiter) acquire(ctx context.Context, op, namespace string) error {
+	_, span := startSpan(ctx, "limiter.acquire", operationKey.String(op), namespaceKey.String(namespace))
+	defer span.End()
+
+	l.mu.Lock()
+	p := l.pools[op]
+	if p.available > 0 && len(p.order) == 0 {
+		p.available--
+		l.mu.Unlock()
+		return nil
+	}
+
+	ready := make(chan struct{})
+	p.enqueue(namespace, ready)
+	l.mu.Unlock()
+
+	limiterQueueDepth.WithLabelValues(op).Inc()
+	defer limiterQueueDepth.WithLabelValues(op).Dec()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		removed := p.remove(namespace, ready)
+		l.mu.Unlock()
+
+		if !removed {
+			// token was granted concurrently, hand it to the next waiter
+			l.release(op)
+		}
+		return ctx.Err()
 	}
-	return &limiter{
-		bucket: b,
+}
+
+// release returns the token of op
+func (l *Limiter) release(op string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	p := l.pools[op]
+	if next := p.dequeue(); next != nil {
+		close(next)
+		return
+	}
+	p.available++
+}
+
+func (p *pool) enqueue(namespace string, ready chan struct{}) {
+	if len(p.queues[namespace]) == 0 {
+		p.order = append(p.order, namespace)
+	}
+	p.queues[namespace] = append(p.queues[namespace], ready)
+}
+
+// dequeue returns the next waiter, taking turns between namespaces
+func (p *pool) dequeue() chan struct{} {
+	if len(p.order) == 0 {
+		return nil
+	}
+
+	namespace := p.order[0]
+	p.order = p.order[1:]
+
+	queue := p.queues[namespace]
+	next := queue[0]
+	if len(queue) == 1 {
+		delete(p.queues, namespace)
+	} else {
+		p.queues[namespace] = queue[1:]
+		// back of the line
+		p.order = append(p.order, namespace)
+	}
+	return next
+}
+
+// remove removes a waiter, returns false if it was already dequeued
+func (p *pool) remove(namespace string, ready chan struct{}) bool {
+	queue := p.queues[namespace]
+	for i, c := range queue {
+		if c != ready {
+			continue
+		}
+
+		queue = append(queue[:i], queue[i+1:]...)
+		if len(queue) > 0 {
+			p.queues[namespace] = queue
+			return true
+		}
+
+		delete(p.queues, namespace)
+		for j, ns := range p.order {
+			if ns == namespace {
+				p.order = append(p.order[:j], p.order[j+1:]...)
+				break
+			}
+		}
+		return true
 	}
+	return false
 }
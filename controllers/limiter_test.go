@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPoolDequeue(t *testing.T) {
+	tests := []struct {
+		name     string
+		enqueued []string // namespaces of waiters in the order they queued
+		removed  []int    // indexes of waiters removed before dequeuing
+		want     []string
+	}{
+		{
+			name: "no waiters",
+		},
+		{
+			name:     "single namespace in order",
+			enqueued: []string{"a", "a", "a"},
+			want:     []string{"a", "a", "a"},
+		},
+		{
+			name:     "namespaces take turns",
+			enqueued: []string{"a", "a", "a", "b", "c"},
+			want:     []string{"a", "b", "c", "a", "a"},
+		},
+		{
+			name:     "interleaved namespaces",
+			enqueued: []string{"a", "b", "b", "a", "b"},
+			want:     []string{"a", "b", "a", "b", "b"},
+		},
+		{
+			name:     "removed waiters",
+			enqueued: []string{"a", "b", "a", "c"},
+			removed:  []int{1, 2},
+			want:     []string{"a", "c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPool(0)
+			waiters := make(map[chan struct{}]string, len(tt.enqueued))
+			chans := make([]chan struct{}, len(tt.enqueued))
+			for i, namespace := range tt.enqueued {
+				chans[i] = make(chan struct{})
+				waiters[chans[i]] = namespace
+				p.enqueue(namespace, chans[i])
+			}
+			for _, i := range tt.removed {
+				if !p.remove(tt.enqueued[i], chans[i]) {
+					t.Fatalf("remove() of waiter %d = false, want true", i)
+				}
+			}
+
+			var got []string
+			for next := p.dequeue(); next != nil; next = p.dequeue() {
+				got = append(got, waiters[next])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("dequeue() = %v, want %v", got, tt.want)
+			}
+			if len(p.queues) != 0 || len(p.order) != 0 {
+				t.Errorf("pool not empty after dequeuing all waiters: queues %v, order %v", p.queues, p.order)
+			}
+		})
+	}
+}
+
+// waitQueued waits until n operations of op are waiting in l
+func waitQueued(t *testing.T, l *Limiter, op string, n int) {
+	t.Helper()
+	for i := 0; i < 1000; i++ {
+		l.mu.Lock()
+		queued := 0
+		for _, q := range l.pools[op].queues {
+			queued += len(q)
+		}
+		l.mu.Unlock()
+
+		if queued == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d queued %s operations", n, op)
+}
+
+func TestLimiterFairQueue(t *testing.T) {
+	l := NewLimiter(1, 1, 1)
+	ctx := context.Background()
+
+	if err := l.acquire(ctx, cloneOperation, "a"); err != nil {
+		t.Fatalf("acquire() error = %v", err)
+	}
+
+	// a large group queues first
+	granted := make(chan string)
+	for i, namespace := range []string{"a", "a", "a", "b", "c"} {
+		go func(namespace string) {
+			if err := l.acquire(ctx, cloneOperation, namespace); err != nil {
+				t.Errorf("acquire() error = %v", err)
+			}
+			granted <- namespace
+		}(namespace)
+		waitQueued(t, l, cloneOperation, i+1)
+	}
+
+	var got []string
+	for i := 0; i < 5; i++ {
+		l.release(cloneOperation)
+		got = append(got, <-granted)
+	}
+	l.release(cloneOperation)
+
+	if want := []string{"a", "b", "c", "a", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("granted %v, want %v", got, want)
+	}
+	if available := l.pools[cloneOperation].available; available != 1 {
+		t.Errorf("available = %d after releasing all tokens, want 1", available)
+	}
+}
+
+func TestLimiterAcquireCanceled(t *testing.T) {
+	l := NewLimiter(1, 1, 1)
+
+	if err := l.acquire(context.Background(), destroyOperation, "a"); err != nil {
+		t.Fatalf("acquire() error = %v", err)
+	}
+
+	// other operation types have their own budget
+	if err := l.acquire(context.Background(), powerOnOperation, "a"); err != nil {
+		t.Fatalf("acquire() of other operation error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.acquire(ctx, destroyOperation, "b"); err != context.DeadlineExceeded {
+		t.Fatalf("acquire() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	p := l.pools[destroyOperation]
+	if len(p.queues) != 0 || len(p.order) != 0 {
+		t.Errorf("canceled waiter still queued: queues %v, order %v", p.queues, p.order)
+	}
+
+	l.release(destroyOperation)
+	if p.available != 1 {
+		t.Errorf("available = %d after release, want 1", p.available)
+	}
+}
@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/vmware/govmomi/task"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const metricsNamespace = "vmoperator"
+
+// vCenter operations tracked in metrics
+const (
+	cloneOperation    = "clone"
+	destroyOperation  = "destroy"
+	powerOnOperation  = "power_on"
+	powerOffOperation = "power_off"
+	snapshotOperation = "snapshot"
+)
+
+var (
+	vcOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "vcenter_operations_total",
+		Help:      "Number of vCenter operations by operation and result.",
+	}, []string{"operation", "result"})
+
+	vcOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "vcenter_operation_duration_seconds",
+		Help:      "Duration of vCenter operations including task wait time.",
+		Buckets:   prometheus.ExponentialBuckets(0.5, 2, 10),
+	}, []string{"operation"})
+
+	vcErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "vcenter_errors_total",
+		Help:      "Number of vCenter API errors by operation and fault type.",
+	}, []string{"operation", "fault"})
+
+	limiterQueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "limiter_queue_depth",
+		Help:      "Number of operations waiting for a vCenter concurrency token by operation.",
+	}, []string{"operation"})
+
+	vmGroupReplicas = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "vmgroup_replicas",
+		Help:      "Number of replicas per VmGroup by type (desired, current, ready).",
+	}, []string{"namespace", "name", "type"})
+
+	sessionRelogins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "vcenter_session_relogins_total",
+		Help:      "Number of vCenter re-logins after a session expired by API (soap, rest).",
+	}, []string{"api"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		vcOperations,
+		vcOperationDuration,
+		vcErrors,
+		limiterQueueDepth,
+		vmGroupReplicas,
+		sessionRelogins,
+	)
+}
+
+// observeOperation records the result and duration of a vCenter operation
+// started at start
+func observeOperation(op string, start time.Time, err error) {
+	vcOperationDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		vcOperations.WithLabelValues(op, "error").Inc()
+		vcErrors.WithLabelValues(op, faultType(err)).Inc()
+		return
+	}
+	vcOperations.WithLabelValues(op, "success").Inc()
+}
+
+// setReplicaMetrics records the replica counts of a VmGroup
+func setReplicaMetrics(namespace, name string, desired, current, ready int32) {
+	vmGroupReplicas.WithLabelValues(namespace, name, "desired").Set(float64(desired))
+	vmGroupReplicas.WithLabelValues(namespace, name, "current").Set(float64(current))
+	vmGroupReplicas.WithLabelValues(namespace, name, "ready").Set(float64(ready))
+}
+
+// deleteReplicaMetrics removes the replica counts of a deleted VmGroup
+func deleteReplicaMetrics(namespace, name string) {
+	for _, t := range []string{"desired", "current", "ready"} {
+		vmGroupReplicas.DeleteLabelValues(namespace, name, t)
+	}
+}
+
+// faultType returns the vSphere fault type of err, e.g. "NotFound", or
+// "unknown" if err is not a vSphere fault
+func faultType(err error) string {
+	var fault interface{}
+
+	switch cause := errors.Cause(err).(type) {
+	case task.Error:
+		fault = cause.Fault()
+	default:
+		if soap.IsSoapFault(cause) {
+			fault = soap.ToSoapFault(cause).VimFault()
+		} else if soap.IsVimFault(cause) {
+			fault = soap.ToVimFault(cause)
+		}
+	}
+
+	if fault == nil {
+		return "unknown"
+	}
+
+	t := reflect.TypeOf(fault)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+// isNotAuthenticated returns true if err is caused by an expired session
+func isNotAuthenticated(err error) bool {
+	return faultType(err) == reflect.TypeOf(types.NotAuthenticated{}).Name()
+}
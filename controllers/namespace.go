@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/object"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"codeconnect/operator/api/v1alpha1"
+)
+
+// getNamespaceConfig returns the VmNamespaceConfig of namespace, nil if the
+// namespace is not isolated
+func getNamespaceConfig(ctx context.Context, c client.Reader, namespace string) (*v1alpha1.VmNamespaceConfig, error) {
+	nc := &v1alpha1.VmNamespaceConfig{}
+	if err := c.Get(ctx, client.ObjectKey{Name: namespace}, nc); err != nil {
+		if k8serr.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "could not get VmNamespaceConfig %q", namespace)
+	}
+	return nc, nil
+}
+
+// namespaceFolder returns the inventory path of the folder of an isolated
+// namespace
+func namespaceFolder(nc *v1alpha1.VmNamespaceConfig) string {
+	name := nc.Spec.Folder
+	if name == "" {
+		name = nc.Name
+	}
+	return vmPath + "/" + name
+}
+
+// namespacePool returns the inventory path of the resource pool of an isolated
+// namespace, created in the default pool unless a parent is set
+func namespacePool(nc *v1alpha1.VmNamespaceConfig, pool *object.ResourcePool) string {
+	parent := pool.InventoryPath
+	if rp := nc.Spec.ResourcePool; rp != nil && rp.Parent != "" {
+		parent = rp.Parent
+	}
+	return parent + "/" + nc.Name
+}
+
+// validateNamespaceSpec returns an error if spec escapes the folder, resource
+// pool or hosts of the namespace or uses a template or network not allowed in
+// the namespace. Templates of VmTemplates are checked with templateAllowed
+// once resolved.
+func validateNamespaceSpec(nc *v1alpha1.VmNamespaceConfig, spec v1alpha1.VmGroupSpec) error {
+	if nc == nil {
+		return nil
+	}
+
+	if pl := spec.Placement; pl != nil && (pl.Folder != "" || pl.Cluster != "" || pl.ResourcePool != "" || pl.Host != "" || pl.HostSelector != "") {
+		return errors.Errorf("placement folder, cluster, resource pool and hosts cannot be set in namespace %q", nc.Name)
+	}
+
+	if spec.RetainFolder != "" && !inFolder(namespaceFolder(nc), spec.RetainFolder) {
+		return errors.Errorf("retain folder %q is not in the folder of namespace %q", spec.RetainFolder, nc.Name)
+	}
+
+	if a := spec.Archive; a != nil {
+		if a.Folder != "" && !inFolder(namespaceFolder(nc), a.Folder) {
+			return errors.Errorf("archive folder %q is not in the folder of namespace %q", a.Folder, nc.Name)
+		}
+		// the filesystem of the operator is shared by all namespaces
+		if a.Path != "" {
+			return errors.Errorf("archive path cannot be set in namespace %q", nc.Name)
+		}
+	}
+
+	if ts := spec.TopologySpread; ts != nil {
+		for _, z := range ts.Zones {
+			if z.Cluster != "" || z.ResourcePool != "" {
+				return errors.Errorf("zone %q: cluster and resource pool cannot be set in namespace %q", z.Name, nc.Name)
+			}
+		}
+	}
+
+	if spec.TemplateRef == nil {
+		src := &templateSource{template: spec.Template, contentLibrary: spec.ContentLibrary}
+		if err := templateAllowed(nc, src); err != nil {
+			return err
+		}
+	}
+
+	if len(nc.Spec.AllowedNetworks) > 0 {
+		if spec.Network == "" {
+			return errors.Errorf("network must be set in namespace %q", nc.Name)
+		}
+		if !matchAny(nc.Spec.AllowedNetworks, spec.Network) {
+			return errors.Errorf("network %q is not allowed in namespace %q", spec.Network, nc.Name)
+		}
+	}
+	return nil
+}
+
+// templateAllowed returns an error if replicas cannot be created from src in
+// the namespace
+func templateAllowed(nc *v1alpha1.VmNamespaceConfig, src *templateSource) error {
+	if nc == nil || len(nc.Spec.AllowedTemplates) == 0 {
+		return nil
+	}
+
+	name := src.template
+	if cl := src.contentLibrary; cl != nil {
+		name = cl.Library + "/" + cl.Item
+	}
+
+	if !matchAny(nc.Spec.AllowedTemplates, name) {
+		return errors.Errorf("template %q is not allowed in namespace %q", name, nc.Name)
+	}
+	return nil
+}
+
+// inFolder returns true if the inventory path p is folder or one of its
+// subfolders
+func inFolder(folder, p string) bool {
+	p = path.Clean(p)
+	return p == folder || strings.HasPrefix(p, folder+"/")
+}
+
+// matchAny returns true if value matches one of the glob patterns. Patterns
+// without a slash match the last element of value, e.g. a template name
+// matches its inventory path.
+func matchAny(patterns []string, value string) bool {
+	for _, p := range patterns {
+		v := value
+		if !strings.Contains(p, "/") {
+			v = path.Base(value)
+		}
+		if ok, _ := path.Match(p, v); ok {
+			return true
+		}
+	}
+	return false
+}
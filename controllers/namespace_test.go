@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"codeconnect/operator/api/v1alpha1"
+)
+
+func TestValidateNamespaceSpec(t *testing.T) {
+	nc := &v1alpha1.VmNamespaceConfig{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}}
+	folder := namespaceFolder(nc)
+
+	tests := []struct {
+		name    string
+		nc      *v1alpha1.VmNamespaceConfig
+		spec    v1alpha1.VmGroupSpec
+		wantErr bool
+	}{
+		{
+			name: "not isolated",
+			spec: v1alpha1.VmGroupSpec{Placement: &v1alpha1.Placement{Host: "esx-1"}, RetainFolder: "/dc/vm/other"},
+		},
+		{
+			name: "no placement",
+			nc:   nc,
+		},
+		{
+			name:    "placement host",
+			nc:      nc,
+			spec:    v1alpha1.VmGroupSpec{Placement: &v1alpha1.Placement{Host: "esx-1"}},
+			wantErr: true,
+		},
+		{
+			name:    "placement host selector",
+			nc:      nc,
+			spec:    v1alpha1.VmGroupSpec{Placement: &v1alpha1.Placement{HostSelector: "esx-*"}},
+			wantErr: true,
+		},
+		{
+			name: "retain folder in namespace folder",
+			nc:   nc,
+			spec: v1alpha1.VmGroupSpec{RetainFolder: folder + "/retained"},
+		},
+		{
+			name:    "retain folder outside namespace folder",
+			nc:      nc,
+			spec:    v1alpha1.VmGroupSpec{RetainFolder: folder + "-b/retained"},
+			wantErr: true,
+		},
+		{
+			name:    "retain folder escaping namespace folder",
+			nc:      nc,
+			spec:    v1alpha1.VmGroupSpec{RetainFolder: folder + "/../team-b"},
+			wantErr: true,
+		},
+		{
+			name: "archive folder in namespace folder",
+			nc:   nc,
+			spec: v1alpha1.VmGroupSpec{Archive: &v1alpha1.Archive{Mode: v1alpha1.CloneArchiveMode, Folder: folder}},
+		},
+		{
+			name:    "archive folder outside namespace folder",
+			nc:      nc,
+			spec:    v1alpha1.VmGroupSpec{Archive: &v1alpha1.Archive{Mode: v1alpha1.CloneArchiveMode, Folder: "/dc/vm/archive"}},
+			wantErr: true,
+		},
+		{
+			name:    "archive path",
+			nc:      nc,
+			spec:    v1alpha1.VmGroupSpec{Archive: &v1alpha1.Archive{Mode: v1alpha1.OVFArchiveMode, Path: "/archive"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateNamespaceSpec(tt.nc, tt.spec); (err != nil) != tt.wantErr {
+				t.Errorf("validateNamespaceSpec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAllocationEqual(t *testing.T) {
+	limit := func(l int64) types.ResourceAllocationInfo {
+		a := types.DefaultResourceConfigSpec().CpuAllocation
+		a.Limit = &l
+		return a
+	}
+
+	tests := []struct {
+		name string
+		a, b types.ResourceAllocationInfo
+		want bool
+	}{
+		{
+			name: "defaults",
+			a:    types.DefaultResourceConfigSpec().CpuAllocation,
+			b:    types.DefaultResourceConfigSpec().CpuAllocation,
+			want: true,
+		},
+		{
+			name: "same limit",
+			a:    limit(1000),
+			b:    limit(1000),
+			want: true,
+		},
+		{
+			name: "limit changed",
+			a:    limit(-1),
+			b:    limit(1000),
+		},
+		{
+			name: "shares changed",
+			a:    types.DefaultResourceConfigSpec().CpuAllocation,
+			b: func() types.ResourceAllocationInfo {
+				a := types.DefaultResourceConfigSpec().CpuAllocation
+				a.Shares = &types.SharesInfo{Level: types.SharesLevelHigh}
+				return a
+			}(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := allocationEqual(tt.a, tt.b); got != tt.want {
+				t.Errorf("allocationEqual() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"codeconnect/operator/api/v1alpha1"
+)
+
+// custom attribute carrying the UID of the VmGroup owning a replica
+const ownerAttribute = "vm-operator.vmgroup"
+
+// ownedReplicas are the vms in a group folder by ownership
+type ownedReplicas struct {
+	owned   []*object.VirtualMachine // marked with the UID of the VmGroup
+	unowned []*object.VirtualMachine // not marked, e.g. created manually
+	foreign []*object.VirtualMachine // marked with the UID of another VmGroup
+}
+
+// ignored returns the vms not owned by the VmGroup
+func (o *ownedReplicas) ignored() []*object.VirtualMachine {
+	return append(append([]*object.VirtualMachine{}, o.unowned...), o.foreign...)
+}
+
+// legacy splits the unowned vms into vms named like replicas of vg, i.e.
+// replicas created before ownership tracking, and others
+func (o *ownedReplicas) legacy(vg *v1alpha1.VmGroup) (legacy, others []*object.VirtualMachine) {
+	for _, vm := range o.unowned {
+		if strings.HasPrefix(vm.Name(), vg.Name+"-replica-") {
+			legacy = append(legacy, vm)
+		} else {
+			others = append(others, vm)
+		}
+	}
+	return legacy, others
+}
+
+// adoptable splits the unowned vms into vms adopted by vg according to its
+// adoption policy and others
+func (o *ownedReplicas) adoptable(vg *v1alpha1.VmGroup) (adopt, others []*object.VirtualMachine) {
+	switch getAdoptionPolicy(vg.Spec) {
+	case v1alpha1.UnownedAdoptionPolicy:
+		return o.unowned, nil
+	case v1alpha1.LegacyAdoptionPolicy:
+		return o.legacy(vg)
+	default:
+		return nil, o.unowned
+	}
+}
+
+// getOwnerKey returns the key of the owner custom attribute, creating it if it
+// does not exist
+func getOwnerKey(ctx context.Context, c *vim25.Client) (int32, error) {
+	m, err := object.GetCustomFieldsManager(c)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not get custom fields manager")
+	}
+
+	key, err := m.FindKey(ctx, ownerAttribute)
+	if err == nil {
+		return key, nil
+	}
+	if err != object.ErrKeyNameNotFound {
+		return 0, errors.Wrapf(err, "could not get custom attribute %q", ownerAttribute)
+	}
+
+	def, err := m.Add(ctx, ownerAttribute, "VirtualMachine", nil, nil)
+	if err != nil {
+		return 0, errors.Wrapf(err, "could not create custom attribute %q", ownerAttribute)
+	}
+	return def.Key, nil
+}
+
+// setOwner marks vm as owned by the VmGroup with uid
+func setOwner(ctx context.Context, vm *object.VirtualMachine, uid string) error {
+	key, err := getOwnerKey(ctx, vm.Client())
+	if err != nil {
+		return err
+	}
+
+	m := object.NewCustomFieldsManager(vm.Client())
+	if err = m.Set(ctx, vm.Reference(), key, uid); err != nil {
+		return errors.Wrapf(err, "could not set owner of vm %q", vm.Name())
+	}
+	return nil
+}
+
+// clearOwner removes the owner of vm, e.g. when it is retained after its
+// VmGroup was deleted
+func clearOwner(ctx context.Context, vm *object.VirtualMachine) error {
+	return setOwner(ctx, vm, "")
+}
+
+// getOwnedReplicas sorts vms by ownership of the VmGroup with uid
+func getOwnedReplicas(ctx context.Context, vms []*object.VirtualMachine, uid string) (*ownedReplicas, error) {
+	o := &ownedReplicas{}
+	if len(vms) == 0 {
+		return o, nil
+	}
+
+	key, err := getOwnerKey(ctx, vms[0].Client())
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make([]types.ManagedObjectReference, len(vms))
+	for i, vm := range vms {
+		refs[i] = vm.Reference()
+	}
+
+	var mos []mo.VirtualMachine
+	pc := property.DefaultCollector(vms[0].Client())
+	if err := pc.Retrieve(ctx, refs, []string{"customValue"}, &mos); err != nil {
+		return nil, errors.Wrap(err, "could not get owner of replicas")
+	}
+
+	owners := make(map[types.ManagedObjectReference]string, len(mos))
+	for _, m := range mos {
+		for _, v := range m.CustomValue {
+			if f, ok := v.(*types.CustomFieldStringValue); ok && f.Key == key {
+				owners[m.Reference()] = f.Value
+			}
+		}
+	}
+
+	for _, vm := range vms {
+		switch owners[vm.Reference()] {
+		case uid:
+			o.owned = append(o.owned, vm)
+		case "":
+			o.unowned = append(o.unowned, vm)
+		default:
+			o.foreign = append(o.foreign, vm)
+		}
+	}
+	return o, nil
+}
+
+// getVmGroupReplicas returns the replicas owned by vg, e.g. for resources
+// referencing a VmGroup
+func getVmGroupReplicas(ctx context.Context, c client.Reader, finder *find.Finder, vg *v1alpha1.VmGroup) ([]*object.VirtualMachine, error) {
+	nc, err := getNamespaceConfig(ctx, c, vg.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	vms, err := getReplicas(ctx, finder, vmFolder(vg, nc), getGroupName(vg.Namespace, vg.Name))
+	if err != nil {
+		return nil, err
+	}
+
+	or, err := getOwnedReplicas(ctx, vms, string(vg.UID))
+	if err != nil {
+		return nil, err
+	}
+	return or.owned, nil
+}
+
+func getAdoptionPolicy(spec v1alpha1.VmGroupSpec) v1alpha1.AdoptionPolicy {
+	if spec.AdoptionPolicy == "" {
+		return v1alpha1.LegacyAdoptionPolicy
+	}
+	return spec.AdoptionPolicy
+}
+
+func getDeletionPolicy(spec v1alpha1.VmGroupSpec) v1alpha1.DeletionPolicy {
+	if spec.DeletionPolicy == "" {
+		return v1alpha1.DeleteDeletionPolicy
+	}
+	return spec.DeletionPolicy
+}
+
+func vmNames(vms []*object.VirtualMachine) []string {
+	names := make([]string, len(vms))
+	for i, vm := range vms {
+		names[i] = vm.Name()
+	}
+	return names
+}
@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vmware/govmomi/object"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"codeconnect/operator/api/v1alpha1"
+)
+
+func TestAdoptable(t *testing.T) {
+	vm := func(name string) *object.VirtualMachine {
+		vm := testVM(name)
+		vm.InventoryPath = "/dc/vm/vg/" + name
+		return vm
+	}
+	names := func(vms []*object.VirtualMachine) []string {
+		var n []string
+		for _, vm := range vms {
+			n = append(n, vm.Name())
+		}
+		return n
+	}
+	or := &ownedReplicas{unowned: []*object.VirtualMachine{vm("vg-replica-1"), vm("manual")}}
+
+	tests := []struct {
+		name       string
+		policy     v1alpha1.AdoptionPolicy
+		wantAdopt  []string
+		wantOthers []string
+	}{
+		{
+			name:       "default",
+			wantAdopt:  []string{"vg-replica-1"},
+			wantOthers: []string{"manual"},
+		},
+		{
+			name:       "legacy",
+			policy:     v1alpha1.LegacyAdoptionPolicy,
+			wantAdopt:  []string{"vg-replica-1"},
+			wantOthers: []string{"manual"},
+		},
+		{
+			name:       "never",
+			policy:     v1alpha1.NeverAdoptionPolicy,
+			wantOthers: []string{"vg-replica-1", "manual"},
+		},
+		{
+			name:      "unowned",
+			policy:    v1alpha1.UnownedAdoptionPolicy,
+			wantAdopt: []string{"vg-replica-1", "manual"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vg := &v1alpha1.VmGroup{
+				ObjectMeta: metav1.ObjectMeta{Name: "vg"},
+				Spec:       v1alpha1.VmGroupSpec{AdoptionPolicy: tt.policy},
+			}
+
+			adopt, others := or.adoptable(vg)
+			if got := names(adopt); !reflect.DeepEqual(got, tt.wantAdopt) {
+				t.Errorf("adopt = %v, want %v", got, tt.wantAdopt)
+			}
+			if got := names(others); !reflect.DeepEqual(got, tt.wantOthers) {
+				t.Errorf("others = %v, want %v", got, tt.wantOthers)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/performance"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// vSphere performance counters, in hundredths of a percent
+const (
+	cpuUsageCounter = "cpu.usage.average"
+	memUsageCounter = "mem.usage.average"
+)
+
+const (
+	realtimeInterval = 20 // seconds
+	usageSamples     = 3  // realtime samples averaged per query, i.e. 1 minute
+)
+
+// groupUsage is the average utilization of the replicas of a VmGroup in percent
+type groupUsage struct {
+	cpu    float64
+	memory float64
+	vms    int // replicas with samples, e.g. powered off replicas have none
+}
+
+// getGroupUsage returns the average CPU and memory utilization of vms over the
+// last usageSamples realtime samples
+func getGroupUsage(ctx context.Context, vms []*object.VirtualMachine) (_ *groupUsage, err error) {
+	ctx, span := startSpan(ctx, "getGroupUsage")
+	defer func() { endSpan(span, err) }()
+
+	usage := &groupUsage{}
+	if len(vms) == 0 {
+		return usage, nil
+	}
+
+	refs := make([]types.ManagedObjectReference, len(vms))
+	for i, vm := range vms {
+		refs[i] = vm.Reference()
+	}
+
+	m := performance.NewManager(vms[0].Client())
+	spec := types.PerfQuerySpec{
+		MaxSample:  usageSamples,
+		IntervalId: realtimeInterval,
+		MetricId:   []types.PerfMetricId{{Instance: ""}}, // aggregate of all instances
+	}
+
+	samples, err := m.SampleByName(ctx, spec, []string{cpuUsageCounter, memUsageCounter}, refs)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not query performance counters")
+	}
+
+	series, err := m.ToMetricSeries(ctx, samples)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not convert performance counters")
+	}
+
+	for _, s := range series {
+		var cpu, mem float64
+		var ok bool
+		for _, v := range s.Value {
+			if len(v.Value) == 0 {
+				continue
+			}
+
+			switch v.Name {
+			case cpuUsageCounter:
+				cpu, ok = average(v.Value), true
+			case memUsageCounter:
+				mem = average(v.Value)
+			}
+		}
+
+		if !ok {
+			continue
+		}
+		usage.cpu += cpu
+		usage.memory += mem
+		usage.vms++
+	}
+
+	if usage.vms > 0 {
+		usage.cpu /= float64(usage.vms)
+		usage.memory /= float64(usage.vms)
+	}
+	return usage, nil
+}
+
+// average returns the average of values in percent
+func average(values []int64) float64 {
+	var sum int64
+	for _, v := range values {
+		sum += v
+	}
+	return float64(sum) / float64(len(values)) / 100
+}
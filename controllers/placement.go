@@ -0,0 +1,235 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+
+	"codeconnect/operator/api/v1alpha1"
+)
+
+// placement is the resolved vCenter location for the replicas of a VmGroup
+type placement struct {
+	zones   []*zone              // single unnamed zone without topology spread
+	hosts   []*object.HostSystem // empty if vCenter (DRS) picks the host
+	folder  string               // inventory path of the parent VM folder
+	maxSkew int32                // allowed replica difference between zones
+}
+
+// zone is a resolved failure zone replicas are placed in
+type zone struct {
+	name      string
+	pool      *object.ResourcePool
+	cluster   *object.ClusterComputeResource // nil if not placed in a cluster
+	datastore *object.Datastore              // nil to use the template datastore
+}
+
+// host returns the host for the i-th replica, spreading replicas across all
+// selected hosts. Returns nil if no host was requested.
+func (p *placement) host(i int) *object.HostSystem {
+	if len(p.hosts) == 0 {
+		return nil
+	}
+	return p.hosts[i%len(p.hosts)]
+}
+
+// spread returns true if replicas are distributed across multiple zones
+func (p *placement) spread() bool {
+	return len(p.zones) > 1
+}
+
+// vmFolder returns the inventory path of the parent folder of the group folder
+// of vg. Existing groups keep the folder recorded in their status, new groups
+// use the namespace folder if the namespace is isolated with nc.
+func vmFolder(vg *v1alpha1.VmGroup, nc *v1alpha1.VmNamespaceConfig) string {
+	if vg.Status.Folder != "" {
+		return vg.Status.Folder
+	}
+	spec := vg.Spec
+	if nc != nil {
+		return namespaceFolder(nc)
+	}
+	if spec.Placement != nil && spec.Placement.Folder != "" {
+		return spec.Placement.Folder
+	}
+	return vmPath
+}
+
+// resolvePlacement looks up the placement targets of vg. Targets not
+// specified fall back to pool and the default VM folder, or the namespace
+// resource pool and folder if the namespace is isolated with nc. If a topology
+// spread is configured, its zones replace the cluster, resource pool and host
+// settings of the placement.
+func resolvePlacement(ctx context.Context, finder *find.Finder, pool *object.ResourcePool, vg *v1alpha1.VmGroup, nc *v1alpha1.VmNamespaceConfig) (*placement, error) {
+	spec := vg.Spec
+	p := &placement{
+		folder:  vmFolder(vg, nc),
+		maxSkew: 1,
+	}
+
+	if nc != nil {
+		rp, err := finder.ResourcePool(ctx, namespacePool(nc, pool))
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not find resource pool of namespace %q", nc.Name)
+		}
+		pool = rp
+	}
+
+	pl := spec.Placement
+	if pl == nil {
+		pl = &v1alpha1.Placement{}
+	}
+
+	if pl.Folder != "" {
+		if _, err := finder.Folder(ctx, pl.Folder); err != nil {
+			return nil, errors.Wrapf(err, "could not find placement folder %q", pl.Folder)
+		}
+	}
+
+	antiAffinity := pl.AntiAffinity != ""
+
+	if ts := spec.TopologySpread; ts != nil {
+		if ts.MaxSkew > 0 {
+			p.maxSkew = ts.MaxSkew
+		}
+
+		for _, zs := range ts.Zones {
+			z, err := resolveZone(ctx, finder, pool, zs.Name, zs.Cluster, zs.ResourcePool, zs.Datastore)
+			if err != nil {
+				return nil, errors.Wrapf(err, "could not resolve zone %q", zs.Name)
+			}
+
+			if antiAffinity {
+				if err = setZoneCluster(ctx, z); err != nil {
+					return nil, errors.Wrapf(err, "could not resolve zone %q", zs.Name)
+				}
+			}
+			p.zones = append(p.zones, z)
+		}
+		return p, nil
+	}
+
+	z, err := resolveZone(ctx, finder, pool, "", pl.Cluster, pl.ResourcePool, "")
+	if err != nil {
+		return nil, err
+	}
+	p.zones = []*zone{z}
+
+	switch {
+	case pl.Host != "":
+		host, err := finder.HostSystem(ctx, pl.Host)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not find placement host %q", pl.Host)
+		}
+		p.hosts = []*object.HostSystem{host}
+
+		// standalone host without explicit pool, use the host root resource pool
+		if z.cluster == nil && pl.ResourcePool == "" {
+			rp, err := host.ResourcePool(ctx)
+			if err != nil {
+				return nil, errors.Wrapf(err, "could not get resource pool for host %q", pl.Host)
+			}
+			z.pool = rp
+		}
+
+	case pl.HostSelector != "":
+		pattern := pl.HostSelector
+		if z.cluster != nil && !strings.Contains(pattern, "/") {
+			pattern = z.cluster.InventoryPath + "/" + pattern
+		}
+
+		hosts, err := finder.HostSystemList(ctx, pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not find placement hosts matching %q", pl.HostSelector)
+		}
+		p.hosts = hosts
+	}
+
+	if antiAffinity {
+		if err = setZoneCluster(ctx, z); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// resolveZone looks up the cluster, resource pool and datastore of a zone.
+// Empty values fall back to pool and the template datastore.
+func resolveZone(ctx context.Context, finder *find.Finder, pool *object.ResourcePool, name, cluster, rp, datastore string) (*zone, error) {
+	z := &zone{
+		name: name,
+		pool: pool,
+	}
+
+	if cluster != "" {
+		c, err := finder.ClusterComputeResource(ctx, cluster)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not find placement cluster %q", cluster)
+		}
+		z.cluster = c
+
+		p, err := c.ResourcePool(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not get resource pool for cluster %q", cluster)
+		}
+		z.pool = p
+	}
+
+	if rp != "" {
+		path := rp
+		if z.cluster != nil && !strings.Contains(path, "/") {
+			// relative to the cluster root resource pool
+			path = z.cluster.InventoryPath + "/Resources/" + path
+		}
+
+		p, err := finder.ResourcePool(ctx, path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not find placement resource pool %q", rp)
+		}
+		z.pool = p
+	}
+
+	if datastore != "" {
+		ds, err := finder.Datastore(ctx, datastore)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not find placement datastore %q", datastore)
+		}
+		z.datastore = ds
+	}
+
+	return z, nil
+}
+
+// setZoneCluster derives the cluster of a zone from its resource pool, required
+// for DRS rules
+func setZoneCluster(ctx context.Context, z *zone) error {
+	c, err := zoneCluster(ctx, z)
+	if err != nil {
+		return err
+	}
+	if c == nil {
+		return errors.New("anti-affinity requires replicas to be placed in a DRS cluster")
+	}
+	z.cluster = c
+	return nil
+}
+
+// zoneCluster returns the cluster of z, the owner of the zone resource pool if
+// no cluster is set. Returns nil if replicas are placed on a standalone host.
+func zoneCluster(ctx context.Context, z *zone) (*object.ClusterComputeResource, error) {
+	if z.cluster != nil {
+		return z.cluster, nil
+	}
+
+	owner, err := z.pool.Owner(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get owner of placement resource pool")
+	}
+
+	c, _ := owner.(*object.ClusterComputeResource)
+	return c, nil
+}
@@ -0,0 +1,298 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/vapi/rest"
+	"github.com/vmware/govmomi/vim25/types"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"codeconnect/operator/api/v1alpha1"
+)
+
+// reasons of the QuotaExceeded condition
+const (
+	quotaExceededReason = "QuotaExceeded"
+	withinQuotaReason   = "WithinQuota"
+)
+
+// quotaUsage are the resources of VmGroups counted against VmQuotas
+type quotaUsage struct {
+	replicas int64
+	cpu      int64
+	memory   int64 // GB
+	disk     int64 // bytes
+}
+
+func (u quotaUsage) add(o quotaUsage) quotaUsage {
+	return quotaUsage{
+		replicas: u.replicas + o.replicas,
+		cpu:      u.cpu + o.cpu,
+		memory:   u.memory + o.memory,
+		disk:     u.disk + o.disk,
+	}
+}
+
+// resources returns u as VmQuota status
+func (u quotaUsage) resources() v1alpha1.VmQuotaResources {
+	replicas, cpu, memory := int32(u.replicas), int32(u.cpu), int32(u.memory)
+	return v1alpha1.VmQuotaResources{
+		Replicas: &replicas,
+		CPU:      &cpu,
+		Memory:   &memory,
+		Disk:     resource.NewQuantity(u.disk, resource.BinarySI),
+	}
+}
+
+// quotaReplicas returns the replicas of vg counted against VmQuotas, the capped
+// replicas if a scale-up was capped by a VmQuota
+func quotaReplicas(vg *v1alpha1.VmGroup) int32 {
+	if c := getCondition(vg.Status.Conditions, v1alpha1.QuotaExceededCondition); c != nil && c.Status == corev1.ConditionTrue {
+		return vg.Status.DesiredReplicas
+	}
+	return vg.Spec.Replicas
+}
+
+// groupQuotaUsage returns the resources of replicas of vg. Disk is only counted
+// once the replica disk is known.
+func groupQuotaUsage(vg *v1alpha1.VmGroup, replicas int32) quotaUsage {
+	n := int64(replicas)
+	u := quotaUsage{
+		replicas: n,
+		cpu:      n * int64(vg.Spec.CPU),
+		memory:   n * int64(vg.Spec.Memory),
+	}
+	if vg.Status.ReplicaDisk != nil {
+		u.disk = n * vg.Status.ReplicaDisk.Value()
+	}
+	return u
+}
+
+// namespaceQuotaUsage returns the resources of all VmGroups in groups except
+// the VmGroup named exclude
+func namespaceQuotaUsage(groups []v1alpha1.VmGroup, exclude string) quotaUsage {
+	var u quotaUsage
+	for i := range groups {
+		if groups[i].Name == exclude {
+			continue
+		}
+		u = u.add(groupQuotaUsage(&groups[i], quotaReplicas(&groups[i])))
+	}
+	return u
+}
+
+// getQuotas returns the VmQuotas and VmGroups of namespace
+func getQuotas(ctx context.Context, c client.Reader, namespace string) ([]v1alpha1.VmQuota, []v1alpha1.VmGroup, error) {
+	var quotas v1alpha1.VmQuotaList
+	if err := c.List(ctx, &quotas, client.InNamespace(namespace)); err != nil {
+		return nil, nil, errors.Wrap(err, "could not list VmQuotas")
+	}
+
+	if len(quotas.Items) == 0 {
+		return nil, nil, nil
+	}
+
+	var groups v1alpha1.VmGroupList
+	if err := c.List(ctx, &groups, client.InNamespace(namespace)); err != nil {
+		return nil, nil, errors.Wrap(err, "could not list VmGroups")
+	}
+	return quotas.Items, groups.Items, nil
+}
+
+// quotaViolations describes the resources exceeding hard in used. Resources
+// not increased from prev are not violations, e.g. after a VmQuota was lowered.
+func quotaViolations(hard v1alpha1.VmQuotaResources, used, prev quotaUsage) []string {
+	var violations []string
+	check := func(name string, limit, used, prev int64, format func(int64) string) {
+		if used > limit && used > prev {
+			violations = append(violations, fmt.Sprintf("%s %s/%s", name, format(used), format(limit)))
+		}
+	}
+
+	count := func(v int64) string { return fmt.Sprintf("%d", v) }
+	if hard.Replicas != nil {
+		check("replicas", int64(*hard.Replicas), used.replicas, prev.replicas, count)
+	}
+	if hard.CPU != nil {
+		check("cpu", int64(*hard.CPU), used.cpu, prev.cpu, count)
+	}
+	if hard.Memory != nil {
+		check("memory", int64(*hard.Memory), used.memory, prev.memory, func(v int64) string { return fmt.Sprintf("%dGB", v) })
+	}
+	if hard.Disk != nil {
+		check("disk", hard.Disk.Value(), used.disk, prev.disk, func(v int64) string {
+			return resource.NewQuantity(v, resource.BinarySI).String()
+		})
+	}
+	return violations
+}
+
+// maxQuotaReplicas returns the most replicas of vg fitting into hard next to
+// the VmGroups using others, at least 0
+func maxQuotaReplicas(hard v1alpha1.VmQuotaResources, others quotaUsage, vg *v1alpha1.VmGroup) int64 {
+	per := groupQuotaUsage(vg, 1)
+	max := int64(-1)
+	limit := func(limit, used, per int64) {
+		if per <= 0 {
+			return
+		}
+		n := (limit - used) / per
+		if n < 0 {
+			n = 0
+		}
+		if max < 0 || n < max {
+			max = n
+		}
+	}
+
+	if hard.Replicas != nil {
+		limit(int64(*hard.Replicas), others.replicas, per.replicas)
+	}
+	if hard.CPU != nil {
+		limit(int64(*hard.CPU), others.cpu, per.cpu)
+	}
+	if hard.Memory != nil {
+		limit(int64(*hard.Memory), others.memory, per.memory)
+	}
+	if hard.Disk != nil {
+		limit(hard.Disk.Value(), others.disk, per.disk)
+	}
+	return max
+}
+
+// needsReplicaDisk returns true if a VmQuota limits disk
+func needsReplicaDisk(quotas []v1alpha1.VmQuota) bool {
+	for _, q := range quotas {
+		if q.Spec.Hard.Disk != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// getReplicaDisk returns the provisioned disk capacity of a replica created
+// from src: the capacity of all virtual disks of a template, the size of a
+// content library item
+func getReplicaDisk(ctx context.Context, finder *find.Finder, rc *rest.Client, src *templateSource) (_ int64, err error) {
+	ctx, span := startSpan(ctx, "getReplicaDisk")
+	defer func() { endSpan(span, err) }()
+
+	if src.contentLibrary != nil {
+		item, err := getLibraryItem(ctx, rc, src.contentLibrary)
+		if err != nil {
+			return 0, err
+		}
+		return item.Size, nil
+	}
+
+	tmpl, err := finder.VirtualMachine(ctx, src.template)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not find template")
+	}
+
+	devices, err := tmpl.Device(ctx)
+	if err != nil {
+		return 0, errors.Wrapf(err, "could not get devices of template %q", src.template)
+	}
+
+	var size int64
+	for _, d := range devices.SelectByType((*types.VirtualDisk)(nil)) {
+		disk := d.(*types.VirtualDisk)
+		if disk.CapacityInBytes > 0 {
+			size += disk.CapacityInBytes
+		} else {
+			size += disk.CapacityInKB * 1024
+		}
+	}
+	return size, nil
+}
+
+// applyQuotas returns desired capped by the VmQuotas of the namespace of vg
+// and sets the QuotaExceeded condition. Existing replicas are never removed
+// to meet a VmQuota.
+func (r *VmGroupReconciler) applyQuotas(ctx context.Context, vg *v1alpha1.VmGroup, src *templateSource, current, desired int32) (int32, error) {
+	quotas, groups, err := getQuotas(ctx, r.Client, vg.Namespace)
+	if err != nil {
+		return desired, err
+	}
+
+	if needsReplicaDisk(quotas) {
+		size, err := getReplicaDisk(ctx, r.Finder, r.Rest, src)
+		if err != nil {
+			return desired, errors.Wrap(err, "could not get replica disk")
+		}
+		vg.Status.ReplicaDisk = resource.NewQuantity(size, resource.BinarySI)
+	}
+
+	others := namespaceQuotaUsage(groups, vg.Name)
+	capped := desired
+	var violations []string
+	for _, q := range quotas {
+		max := maxQuotaReplicas(q.Spec.Hard, others, vg)
+		if max < 0 || int64(capped) <= max {
+			continue
+		}
+
+		capped = int32(max)
+		violations = append(violations, fmt.Sprintf("VmQuota %q (%s)", q.Name,
+			strings.Join(quotaViolations(q.Spec.Hard, others.add(groupQuotaUsage(vg, desired)), quotaUsage{}), ", ")))
+	}
+
+	// scale-downs are never blocked
+	if capped < current {
+		capped = current
+	}
+	if capped > desired {
+		capped = desired
+	}
+
+	if capped < desired {
+		setCondition(&vg.Status.Conditions, v1alpha1.Condition{
+			Type:    v1alpha1.QuotaExceededCondition,
+			Status:  corev1.ConditionTrue,
+			Reason:  quotaExceededReason,
+			Message: fmt.Sprintf("scale-up capped at %d of %d replica(s) by %s", capped, desired, strings.Join(violations, ", ")),
+		})
+		return capped, nil
+	}
+
+	if getCondition(vg.Status.Conditions, v1alpha1.QuotaExceededCondition) != nil {
+		setCondition(&vg.Status.Conditions, v1alpha1.Condition{
+			Type:   v1alpha1.QuotaExceededCondition,
+			Status: corev1.ConditionFalse,
+			Reason: withinQuotaReason,
+		})
+	}
+	return desired, nil
+}
+
+// getCondition returns the condition of type t, nil if not set
+func getCondition(conditions []v1alpha1.Condition, t v1alpha1.ConditionType) *v1alpha1.Condition {
+	for i := range conditions {
+		if conditions[i].Type == t {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
+
+// setCondition adds or updates the condition of the type of c. The last
+// transition time is kept if the status did not change.
+func setCondition(conditions *[]v1alpha1.Condition, c v1alpha1.Condition) {
+	c.LastTransitionTime = metav1.Now()
+	if existing := getCondition(*conditions, c.Type); existing != nil {
+		if existing.Status == c.Status {
+			c.LastTransitionTime = existing.LastTransitionTime
+		}
+		*existing = c
+		return
+	}
+	*conditions = append(*conditions, c)
+}
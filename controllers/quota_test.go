@@ -0,0 +1,200 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"codeconnect/operator/api/v1alpha1"
+)
+
+func testGroup(name string, replicas, cpu, memory int32, disk string) v1alpha1.VmGroup {
+	vg := v1alpha1.VmGroup{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       v1alpha1.VmGroupSpec{Replicas: replicas, CPU: cpu, Memory: memory},
+	}
+	if disk != "" {
+		q := resource.MustParse(disk)
+		vg.Status.ReplicaDisk = &q
+	}
+	return vg
+}
+
+func TestQuotaReplicas(t *testing.T) {
+	capped := testGroup("capped", 5, 1, 1, "")
+	capped.Status.DesiredReplicas = 3
+	capped.Status.Conditions = []v1alpha1.Condition{{Type: v1alpha1.QuotaExceededCondition, Status: corev1.ConditionTrue}}
+
+	within := testGroup("within", 5, 1, 1, "")
+	within.Status.DesiredReplicas = 3
+	within.Status.Conditions = []v1alpha1.Condition{{Type: v1alpha1.QuotaExceededCondition, Status: corev1.ConditionFalse}}
+
+	tests := []struct {
+		name string
+		vg   v1alpha1.VmGroup
+		want int32
+	}{
+		{name: "no condition", vg: testGroup("new", 5, 1, 1, ""), want: 5},
+		{name: "capped by quota", vg: capped, want: 3},
+		{name: "within quota", vg: within, want: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := quotaReplicas(&tt.vg); got != tt.want {
+				t.Errorf("quotaReplicas() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNamespaceQuotaUsage(t *testing.T) {
+	groups := []v1alpha1.VmGroup{
+		testGroup("a", 2, 2, 4, "10Gi"),
+		testGroup("b", 3, 1, 2, ""),
+		testGroup("c", 1, 4, 8, "20Gi"),
+	}
+
+	tests := []struct {
+		name    string
+		exclude string
+		want    quotaUsage
+	}{
+		{
+			name: "all groups",
+			want: quotaUsage{replicas: 6, cpu: 11, memory: 22, disk: 40 << 30},
+		},
+		{
+			name:    "excluded group",
+			exclude: "c",
+			want:    quotaUsage{replicas: 5, cpu: 7, memory: 14, disk: 20 << 30},
+		},
+		{
+			name:    "unknown disk not counted",
+			exclude: "a",
+			want:    quotaUsage{replicas: 4, cpu: 7, memory: 14, disk: 20 << 30},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := namespaceQuotaUsage(groups, tt.exclude); got != tt.want {
+				t.Errorf("namespaceQuotaUsage() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuotaViolations(t *testing.T) {
+	disk := resource.MustParse("100Gi")
+	hard := v1alpha1.VmQuotaResources{
+		Replicas: int32Ptr(10),
+		CPU:      int32Ptr(20),
+		Memory:   int32Ptr(40),
+		Disk:     &disk,
+	}
+
+	tests := []struct {
+		name string
+		hard v1alpha1.VmQuotaResources
+		used quotaUsage
+		prev quotaUsage
+		want []string
+	}{
+		{
+			name: "within quota",
+			hard: hard,
+			used: quotaUsage{replicas: 10, cpu: 20, memory: 40, disk: 100 << 30},
+		},
+		{
+			name: "unlimited",
+			used: quotaUsage{replicas: 100, cpu: 100, memory: 100, disk: 1 << 40},
+		},
+		{
+			name: "all exceeded",
+			hard: hard,
+			used: quotaUsage{replicas: 11, cpu: 22, memory: 44, disk: 110 << 30},
+			want: []string{"replicas 11/10", "cpu 22/20", "memory 44GB/40GB", "disk 110Gi/100Gi"},
+		},
+		{
+			name: "exceeded before but not increased",
+			hard: hard,
+			used: quotaUsage{replicas: 11, cpu: 22, memory: 44},
+			prev: quotaUsage{replicas: 12, cpu: 22, memory: 40},
+			want: []string{"memory 44GB/40GB"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := quotaViolations(tt.hard, tt.used, tt.prev); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("quotaViolations() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxQuotaReplicas(t *testing.T) {
+	disk := resource.MustParse("100Gi")
+	vg := testGroup("vg", 1, 2, 4, "10Gi")
+
+	tests := []struct {
+		name   string
+		hard   v1alpha1.VmQuotaResources
+		others quotaUsage
+		vg     v1alpha1.VmGroup
+		want   int64
+	}{
+		{
+			name: "unlimited",
+			vg:   vg,
+			want: -1,
+		},
+		{
+			name:   "replicas",
+			hard:   v1alpha1.VmQuotaResources{Replicas: int32Ptr(10)},
+			others: quotaUsage{replicas: 4},
+			vg:     vg,
+			want:   6,
+		},
+		{
+			name:   "lowest of all resources",
+			hard:   v1alpha1.VmQuotaResources{Replicas: int32Ptr(10), CPU: int32Ptr(12), Memory: int32Ptr(40)},
+			others: quotaUsage{replicas: 2, cpu: 4, memory: 8},
+			vg:     vg,
+			want:   4,
+		},
+		{
+			name:   "disk",
+			hard:   v1alpha1.VmQuotaResources{Disk: &disk},
+			others: quotaUsage{disk: 75 << 30},
+			vg:     vg,
+			want:   2,
+		},
+		{
+			name:   "unknown disk not limited",
+			hard:   v1alpha1.VmQuotaResources{Disk: &disk},
+			others: quotaUsage{disk: 75 << 30},
+			vg:     testGroup("vg", 1, 2, 4, ""),
+			want:   -1,
+		},
+		{
+			name:   "already exceeded",
+			hard:   v1alpha1.VmQuotaResources{CPU: int32Ptr(4)},
+			others: quotaUsage{cpu: 8},
+			vg:     vg,
+			want:   0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := maxQuotaReplicas(tt.hard, tt.others, &tt.vg); got != tt.want {
+				t.Errorf("maxQuotaReplicas() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
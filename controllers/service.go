@@ -0,0 +1,366 @@
+package controllers
+
+import (
+	"context"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	corev1 "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1beta1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	toolscache "k8s.io/client-go/tools/cache"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	vmv1alpha1 "codeconnect/operator/api/v1alpha1"
+)
+
+const (
+	// guest IPs are not watched, VmGroups with a Service are resynced instead
+	serviceResync = time.Minute
+
+	endpointSliceManager = "vm-operator.codeconnect.vmworld.com"
+	// the EndpointSlice is managed by the operator, not mirrored from the
+	// Endpoints (Kubernetes 1.19+)
+	skipMirrorLabel = "endpointslice.kubernetes.io/skip-mirror"
+)
+
+// serviceInformers returns informers of the Services and Endpoints labeled
+// with the VmGroup label. They are started by mgr.
+func serviceInformers(mgr ctrl.Manager) (services, endpoints toolscache.SharedIndexInformer, err error) {
+	cs, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "could not create clientset")
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(cs, 0, informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+		o.LabelSelector = VmGroupLabel
+	}))
+	services = factory.Core().V1().Services().Informer()
+	endpoints = factory.Core().V1().Endpoints().Informer()
+
+	err = mgr.Add(manager.RunnableFunc(func(stop <-chan struct{}) error {
+		factory.Start(stop)
+		<-stop
+		return nil
+	}))
+	return services, endpoints, errors.Wrap(err, "could not add service informers")
+}
+
+// serviceClient reads from the API server instead of the manager cache
+func (r *VmGroupReconciler) serviceClient() client.Client {
+	return client.DelegatingClient{Reader: r.APIReader, Writer: r.Client, StatusClient: r.Client}
+}
+
+// checkControlled returns an error if obj exists and is not controlled by vg,
+// e.g. a Service named like the VmGroup created by a user
+func checkControlled(obj metav1.Object, vg *vmv1alpha1.VmGroup) error {
+	if obj.GetResourceVersion() != "" && !metav1.IsControlledBy(obj, vg) {
+		return errors.Errorf("%q exists and is not controlled by VmGroup", obj.GetName())
+	}
+	return nil
+}
+
+// replicaAddress is the guest IPv4 address of a replica
+type replicaAddress struct {
+	ip    string
+	ready bool
+}
+
+// getReplicaAddresses returns the guest IPv4 addresses of vms reported by
+// VMware Tools sorted by IP. Replicas without address are skipped.
+func getReplicaAddresses(ctx context.Context, vms []*object.VirtualMachine) (_ []replicaAddress, err error) {
+	ctx, span := startSpan(ctx, "getReplicaAddresses")
+	defer func() { endSpan(span, err) }()
+
+	if len(vms) == 0 {
+		return nil, nil
+	}
+
+	refs := make([]types.ManagedObjectReference, len(vms))
+	for i, vm := range vms {
+		refs[i] = vm.Reference()
+	}
+
+	var mos []mo.VirtualMachine
+	pc := property.DefaultCollector(vms[0].Client())
+	if err := pc.Retrieve(ctx, refs, []string{"runtime.powerState", "guestHeartbeatStatus", "guest.ipAddress", "guest.net"}, &mos); err != nil {
+		return nil, errors.Wrap(err, "could not get guest IPs of replicas")
+	}
+
+	var addrs []replicaAddress
+	for _, m := range mos {
+		if ip := guestIPv4(m.Guest); ip != "" {
+			addrs = append(addrs, replicaAddress{ip: ip, ready: isReady(m)})
+		}
+	}
+
+	sort.Slice(addrs, func(i, j int) bool {
+		return addrs[i].ip < addrs[j].ip
+	})
+	return addrs, nil
+}
+
+// guestIPv4 returns the primary guest IP if it is an IPv4 address, otherwise
+// the first IPv4 address of the guest NICs
+func guestIPv4(guest *types.GuestInfo) string {
+	if guest == nil {
+		return ""
+	}
+
+	if ip := net.ParseIP(guest.IpAddress); ip != nil && ip.To4() != nil {
+		return guest.IpAddress
+	}
+
+	for _, nic := range guest.Net {
+		for _, a := range nic.IpAddress {
+			if ip := net.ParseIP(a); ip != nil && ip.To4() != nil && !ip.IsLinkLocalUnicast() {
+				return a
+			}
+		}
+	}
+	return ""
+}
+
+// syncService keeps the Service, Endpoints and EndpointSlice of vg in sync
+// with the guest IPs of its replicas. They are deleted if no Service is set in
+// the spec. VmGroups without Service never read Services, Endpoints or
+// EndpointSlices.
+func (r *VmGroupReconciler) syncService(ctx context.Context, pl *placement, vg *vmv1alpha1.VmGroup) error {
+	if vg.Spec.Service == nil {
+		if vg.Status.Service == "" {
+			return nil
+		}
+		if err := r.deleteService(ctx, vg); err != nil {
+			return err
+		}
+		vg.Status.Service = ""
+		return nil
+	}
+
+	or, err := r.getOwnedReplicas(ctx, pl.folder, vg)
+	if err != nil {
+		return errors.Wrap(err, "could not get replicas for service")
+	}
+
+	addrs, err := getReplicaAddresses(ctx, or.owned)
+	if err != nil {
+		return err
+	}
+
+	if err = r.ensureService(ctx, vg); err != nil {
+		return err
+	}
+	vg.Status.Service = vg.Name
+
+	if err = r.ensureEndpoints(ctx, vg, addrs); err != nil {
+		return err
+	}
+
+	return r.ensureEndpointSlice(ctx, vg, addrs)
+}
+
+// ensureService creates or updates the Service of vg
+func (r *VmGroupReconciler) ensureService(ctx context.Context, vg *vmv1alpha1.VmGroup) error {
+	spec := vg.Spec.Service
+	svc := &corev1.Service{}
+	key := client.ObjectKey{Namespace: vg.Namespace, Name: vg.Name}
+
+	c := r.serviceClient()
+	err := c.Get(ctx, key, svc)
+	if client.IgnoreNotFound(err) != nil {
+		return errors.Wrap(err, "could not get service")
+	}
+
+	if err == nil {
+		if cerr := checkControlled(svc, vg); cerr != nil {
+			return errors.Wrap(cerr, "could not update service")
+		}
+	}
+
+	// cluster IP is immutable
+	if err == nil && (svc.Spec.ClusterIP == corev1.ClusterIPNone) != spec.Headless {
+		if err = c.Delete(ctx, svc); client.IgnoreNotFound(err) != nil {
+			return errors.Wrap(err, "could not recreate service")
+		}
+		err = k8serr.NewNotFound(corev1.Resource("services"), vg.Name)
+	}
+
+	if k8serr.IsNotFound(err) {
+		svc = &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: vg.Namespace, Name: vg.Name}}
+		if err = mutateService(svc, vg, r.Scheme); err != nil {
+			return err
+		}
+		if spec.Headless {
+			svc.Spec.ClusterIP = corev1.ClusterIPNone
+		}
+		return errors.Wrap(c.Create(ctx, svc), "could not create service")
+	}
+
+	_, err = controllerutil.CreateOrUpdate(ctx, c, svc, func() error {
+		if err := checkControlled(svc, vg); err != nil {
+			return err
+		}
+		return mutateService(svc, vg, r.Scheme)
+	})
+	return errors.Wrap(err, "could not update service")
+}
+
+func mutateService(svc *corev1.Service, vg *vmv1alpha1.VmGroup, scheme *runtime.Scheme) error {
+	if svc.Labels == nil {
+		svc.Labels = make(map[string]string)
+	}
+	svc.Labels[VmGroupLabel] = vg.Name
+
+	var ports []corev1.ServicePort
+	for _, p := range vg.Spec.Service.Ports {
+		ports = append(ports, corev1.ServicePort{
+			Name:       p.Name,
+			Protocol:   getProtocol(p),
+			Port:       p.Port,
+			TargetPort: intstr.FromInt(int(getTargetPort(p))),
+		})
+	}
+	svc.Spec.Ports = ports
+	svc.Spec.Type = corev1.ServiceTypeClusterIP
+
+	return controllerutil.SetControllerReference(vg, svc, scheme)
+}
+
+// ensureEndpoints creates or updates the Endpoints of the Service of vg
+func (r *VmGroupReconciler) ensureEndpoints(ctx context.Context, vg *vmv1alpha1.VmGroup, addrs []replicaAddress) error {
+	ep := &corev1.Endpoints{ObjectMeta: metav1.ObjectMeta{Namespace: vg.Namespace, Name: vg.Name}}
+
+	_, err := controllerutil.CreateOrUpdate(ctx, r.serviceClient(), ep, func() error {
+		if err := checkControlled(ep, vg); err != nil {
+			return err
+		}
+		if ep.Labels == nil {
+			ep.Labels = make(map[string]string)
+		}
+		ep.Labels[VmGroupLabel] = vg.Name
+		ep.Labels[skipMirrorLabel] = "true"
+
+		ep.Subsets = nil
+		if len(addrs) > 0 {
+			subset := corev1.EndpointSubset{}
+			for _, a := range addrs {
+				if a.ready {
+					subset.Addresses = append(subset.Addresses, corev1.EndpointAddress{IP: a.ip})
+				} else {
+					subset.NotReadyAddresses = append(subset.NotReadyAddresses, corev1.EndpointAddress{IP: a.ip})
+				}
+			}
+
+			for _, p := range vg.Spec.Service.Ports {
+				subset.Ports = append(subset.Ports, corev1.EndpointPort{
+					Name:     p.Name,
+					Protocol: getProtocol(p),
+					Port:     getTargetPort(p),
+				})
+			}
+			ep.Subsets = []corev1.EndpointSubset{subset}
+		}
+
+		return controllerutil.SetControllerReference(vg, ep, r.Scheme)
+	})
+	return errors.Wrap(err, "could not update endpoints")
+}
+
+// ensureEndpointSlice creates or updates the EndpointSlice of the Service of vg
+func (r *VmGroupReconciler) ensureEndpointSlice(ctx context.Context, vg *vmv1alpha1.VmGroup, addrs []replicaAddress) error {
+	slice := &discovery.EndpointSlice{ObjectMeta: metav1.ObjectMeta{Namespace: vg.Namespace, Name: vg.Name}}
+
+	_, err := controllerutil.CreateOrUpdate(ctx, r.serviceClient(), slice, func() error {
+		if err := checkControlled(slice, vg); err != nil {
+			return err
+		}
+		if slice.Labels == nil {
+			slice.Labels = make(map[string]string)
+		}
+		slice.Labels[VmGroupLabel] = vg.Name
+		slice.Labels[discovery.LabelServiceName] = vg.Name
+		slice.Labels[discovery.LabelManagedBy] = endpointSliceManager
+		slice.AddressType = discovery.AddressTypeIPv4
+
+		slice.Endpoints = nil
+		for _, a := range addrs {
+			ready := a.ready
+			slice.Endpoints = append(slice.Endpoints, discovery.Endpoint{
+				Addresses:  []string{a.ip},
+				Conditions: discovery.EndpointConditions{Ready: &ready},
+			})
+		}
+
+		slice.Ports = nil
+		for _, p := range vg.Spec.Service.Ports {
+			name, protocol, port := p.Name, getProtocol(p), getTargetPort(p)
+			slice.Ports = append(slice.Ports, discovery.EndpointPort{
+				Name:     &name,
+				Protocol: &protocol,
+				Port:     &port,
+			})
+		}
+
+		return controllerutil.SetControllerReference(vg, slice, r.Scheme)
+	})
+	if meta.IsNoMatchError(err) {
+		// EndpointSlices are not served before Kubernetes 1.17
+		return nil
+	}
+	return errors.Wrap(err, "could not update endpoint slice")
+}
+
+// deleteService deletes the Service, Endpoints and EndpointSlice of vg if they
+// exist and are controlled by vg
+func (r *VmGroupReconciler) deleteService(ctx context.Context, vg *vmv1alpha1.VmGroup) error {
+	key := client.ObjectKey{Namespace: vg.Namespace, Name: vg.Name}
+
+	c := r.serviceClient()
+	for _, obj := range []runtime.Object{&corev1.Service{}, &corev1.Endpoints{}, &discovery.EndpointSlice{}} {
+		if err := c.Get(ctx, key, obj); err != nil {
+			if k8serr.IsNotFound(err) || meta.IsNoMatchError(err) {
+				continue
+			}
+			return errors.Wrap(err, "could not get service")
+		}
+
+		// e.g. a Service named like the VmGroup created by a user
+		if m, ok := obj.(metav1.Object); !ok || !metav1.IsControlledBy(m, vg) {
+			continue
+		}
+
+		if err := c.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+			return errors.Wrap(err, "could not delete service")
+		}
+	}
+	return nil
+}
+
+func getProtocol(p vmv1alpha1.ServicePort) corev1.Protocol {
+	if p.Protocol == "" {
+		return corev1.ProtocolTCP
+	}
+	return p.Protocol
+}
+
+func getTargetPort(p vmv1alpha1.ServicePort) int32 {
+	if p.TargetPort == 0 {
+		return p.Port
+	}
+	return p.TargetPort
+}
@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	vmv1alpha1 "codeconnect/operator/api/v1alpha1"
+)
+
+func TestCheckControlled(t *testing.T) {
+	vg := &vmv1alpha1.VmGroup{ObjectMeta: metav1.ObjectMeta{Name: "vg", UID: types.UID("vg-uid")}}
+	controller := true
+	ownedBy := func(uid types.UID) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{Name: "vg", UID: uid, Controller: &controller}}
+	}
+
+	tests := []struct {
+		name    string
+		svc     *corev1.Service
+		wantErr bool
+	}{
+		{
+			name: "not created yet",
+			svc:  &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "vg"}},
+		},
+		{
+			name: "controlled by VmGroup",
+			svc:  &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "vg", ResourceVersion: "1", OwnerReferences: ownedBy("vg-uid")}},
+		},
+		{
+			name:    "created by user",
+			svc:     &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "vg", ResourceVersion: "1"}},
+			wantErr: true,
+		},
+		{
+			name:    "controlled by other VmGroup",
+			svc:     &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "vg", ResourceVersion: "1", OwnerReferences: ownedBy("other-uid")}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkControlled(tt.svc, vg); (err != nil) != tt.wantErr {
+				t.Errorf("checkControlled() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package controllers
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/session"
+	"github.com/vmware/govmomi/vapi/rest"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/soap"
+)
+
+// KeepAlive keeps the vCenter SOAP and REST sessions alive by sending a
+// request every idle interval. Expired sessions are logged in again with user.
+func KeepAlive(ctx context.Context, c *govmomi.Client, rc *rest.Client, user *url.Userinfo, idle time.Duration, log logr.Logger) {
+	c.Client.RoundTripper = session.KeepAliveHandler(c.Client.RoundTripper, idle, func(rt soap.RoundTripper) error {
+		_, err := methods.GetCurrentTime(ctx, rt)
+		if err != nil && isNotAuthenticated(err) {
+			log.Info("vCenter session expired, logging in again")
+			if err = c.Login(ctx, user); err != nil {
+				log.Error(err, "could not login to vCenter")
+				return err
+			}
+			sessionRelogins.WithLabelValues("soap").Inc()
+		}
+
+		s, err := rc.Session(ctx)
+		if err != nil {
+			log.Error(err, "could not get vCenter REST API session")
+			return nil
+		}
+
+		// no active session
+		if s == nil {
+			log.Info("vCenter REST API session expired, logging in again")
+			if err = rc.Login(ctx, user); err != nil {
+				log.Error(err, "could not login to vCenter REST API")
+				return nil
+			}
+			sessionRelogins.WithLabelValues("rest").Inc()
+		}
+		return nil
+	})
+}
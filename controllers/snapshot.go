@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/object"
+)
+
+// createSnapshot creates the snapshot name of vm
+func createSnapshot(ctx context.Context, vm *object.VirtualMachine, name string, memory, quiesce bool) (err error) {
+	defer func(start time.Time) {
+		observeOperation(snapshotOperation, start, err)
+	}(time.Now())
+
+	ctx, span := startSpan(ctx, "createSnapshot", vmKey.String(vm.Name()))
+	defer func() { endSpan(span, err) }()
+
+	task, err := vm.CreateSnapshot(ctx, name, "created by vm-operator", memory, quiesce)
+	if err != nil {
+		return errors.Wrap(err, "could not initiate snapshot task")
+	}
+
+	return errors.Wrapf(waitTask(ctx, task), "could not create snapshot %q of vm %q", name, vm.Name())
+}
+
+// removeSnapshot removes the snapshot name of vm if it exists
+func removeSnapshot(ctx context.Context, vm *object.VirtualMachine, name string) (err error) {
+	ctx, span := startSpan(ctx, "removeSnapshot", vmKey.String(vm.Name()))
+	defer func() { endSpan(span, err) }()
+
+	task, err := vm.RemoveSnapshot(ctx, name, false, nil)
+	if err != nil {
+		if isSnapshotNotFound(err) {
+			return nil
+		}
+		return errors.Wrap(err, "could not initiate remove snapshot task")
+	}
+
+	return errors.Wrapf(waitTask(ctx, task), "could not remove snapshot %q of vm %q", name, vm.Name())
+}
+
+// revertSnapshot reverts vm to the snapshot name, the power state of the
+// snapshot is restored
+func revertSnapshot(ctx context.Context, vm *object.VirtualMachine, name string) (err error) {
+	ctx, span := startSpan(ctx, "revertSnapshot", vmKey.String(vm.Name()))
+	defer func() { endSpan(span, err) }()
+
+	task, err := vm.RevertToSnapshot(ctx, name, false)
+	if err != nil {
+		return errors.Wrap(err, "could not initiate revert snapshot task")
+	}
+
+	return errors.Wrapf(waitTask(ctx, task), "could not revert vm %q to snapshot %q", vm.Name(), name)
+}
+
+// underlying FindSnapshot error is not typed
+func isSnapshotNotFound(err error) bool {
+	return strings.Contains(err.Error(), snapshotNotFoundErr) || strings.Contains(err.Error(), noSnapshotsErr)
+}
@@ -0,0 +1,290 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/vapi/rest"
+	"github.com/vmware/govmomi/vapi/tags"
+	"github.com/vmware/govmomi/vim25/mo"
+
+	"codeconnect/operator/api/v1alpha1"
+)
+
+const (
+	// category of the tags linking vCenter objects to their VmGroup
+	ownerTagCategory = "k8s-vmgroup"
+	// cardinality of categories created by the operator
+	multipleCardinality = "MULTIPLE"
+)
+
+// Tagger attaches vSphere tags to VmGroup folders and replicas. Categories and
+// tags are created if absent, their IDs are cached.
+type Tagger struct {
+	m         *tags.Manager
+	clusterID string
+
+	mu  sync.Mutex
+	ids map[string]string // tag IDs by category and name
+}
+
+// NewTagger returns a Tagger using the vCenter REST API. The clusterID is
+// added to the owner tags to distinguish VmGroups of multiple Kubernetes
+// clusters sharing a vCenter.
+func NewTagger(rc *rest.Client, clusterID string) *Tagger {
+	return &Tagger{
+		m:         tags.NewManager(rc),
+		clusterID: clusterID,
+		ids:       make(map[string]string),
+	}
+}
+
+// ownerTags returns the tags linking objects to vg
+func (t *Tagger) ownerTags(vg *v1alpha1.VmGroup) []v1alpha1.Tag {
+	return []v1alpha1.Tag{
+		{Category: ownerTagCategory, Name: "cluster=" + t.clusterID},
+		{Category: ownerTagCategory, Name: "namespace=" + vg.Namespace},
+		{Category: ownerTagCategory, Name: "name=" + vg.Name},
+		{Category: ownerTagCategory, Name: "uid=" + string(vg.UID)},
+	}
+}
+
+// sync attaches the owner tags and spec.tags of vg to objects and detaches the
+// tags in status.tags removed from spec.tags. status.tags is set to spec.tags
+// on success.
+func (t *Tagger) sync(ctx context.Context, vg *v1alpha1.VmGroup, objects []mo.Reference) error {
+	if len(objects) == 0 {
+		return nil
+	}
+
+	for _, tag := range removedTags(vg.Status.Tags, vg.Spec.Tags) {
+		if err := t.detachTag(ctx, tag, objects); err != nil {
+			return err
+		}
+	}
+
+	attached, err := t.m.ListAttachedTagsOnObjects(ctx, objects)
+	if err != nil {
+		return errors.Wrap(err, "could not list attached tags")
+	}
+
+	has := make(map[string]map[string]bool) // object IDs by tag ID
+	for _, a := range attached {
+		for _, id := range a.TagIDs {
+			if has[id] == nil {
+				has[id] = make(map[string]bool)
+			}
+			has[id][a.ObjectID.Reference().Value] = true
+		}
+	}
+
+	for _, tag := range append(t.ownerTags(vg), vg.Spec.Tags...) {
+		id, err := t.ensureTag(ctx, tag)
+		if err != nil {
+			return err
+		}
+
+		var missing []mo.Reference
+		for _, o := range objects {
+			if !has[id][o.Reference().Value] {
+				missing = append(missing, o)
+			}
+		}
+
+		if len(missing) == 0 {
+			continue
+		}
+
+		if err = t.m.AttachTagToMultipleObjects(ctx, id, missing); err != nil {
+			return errors.Wrapf(err, "could not attach tag %q", tag.Category+"/"+tag.Name)
+		}
+	}
+
+	vg.Status.Tags = append([]v1alpha1.Tag(nil), vg.Spec.Tags...)
+	return nil
+}
+
+// removedTags returns the tags in status not in spec
+func removedTags(status, spec []v1alpha1.Tag) []v1alpha1.Tag {
+	desired := make(map[v1alpha1.Tag]bool, len(spec))
+	for _, tag := range spec {
+		desired[tag] = true
+	}
+
+	var removed []v1alpha1.Tag
+	for _, tag := range status {
+		if !desired[tag] {
+			removed = append(removed, tag)
+		}
+	}
+	return removed
+}
+
+// detachOwnerTags detaches the owner tags of vg from objects
+func (t *Tagger) detachOwnerTags(ctx context.Context, vg *v1alpha1.VmGroup, objects []mo.Reference) error {
+	for _, tag := range t.ownerTags(vg) {
+		if err := t.detachTag(ctx, tag, objects); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// detachTag detaches tag from objects, tags which do not exist are skipped
+func (t *Tagger) detachTag(ctx context.Context, tag v1alpha1.Tag, objects []mo.Reference) error {
+	id, err := t.findTag(ctx, tag)
+	if err != nil || id == "" {
+		return err
+	}
+
+	for _, o := range objects {
+		if err = t.m.DetachTag(ctx, id, o); err != nil {
+			return errors.Wrapf(err, "could not detach tag %q", tag.Category+"/"+tag.Name)
+		}
+	}
+	return nil
+}
+
+// deleteOwnerTag deletes the tag with the UID of vg which is not shared with
+// other VmGroups. A tag which does not exist is not an error.
+func (t *Tagger) deleteOwnerTag(ctx context.Context, vg *v1alpha1.VmGroup) error {
+	tag := v1alpha1.Tag{Category: ownerTagCategory, Name: "uid=" + string(vg.UID)}
+	id, err := t.findTag(ctx, tag)
+	if err != nil || id == "" {
+		return err
+	}
+
+	// the cached ID is stale once the tag is deleted or failed to be deleted,
+	// e.g. because it was deleted concurrently
+	t.mu.Lock()
+	delete(t.ids, tag.Category+"/"+tag.Name)
+	t.mu.Unlock()
+
+	if err = t.m.DeleteTag(ctx, &tags.Tag{ID: id}); err != nil && !isNotFound(err) {
+		return errors.Wrapf(err, "could not delete tag %q", tag.Category+"/"+tag.Name)
+	}
+	return nil
+}
+
+// isNotFound returns true if err is a vCenter REST API 404 response
+func isNotFound(err error) bool {
+	return strings.Contains(err.Error(), http.StatusText(http.StatusNotFound))
+}
+
+// findTag returns the ID of tag, an empty ID if the tag or its category do not
+// exist
+func (t *Tagger) findTag(ctx context.Context, tag v1alpha1.Tag) (string, error) {
+	key := tag.Category + "/" + tag.Name
+
+	t.mu.Lock()
+	id, ok := t.ids[key]
+	t.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	categoryID, err := t.findCategory(ctx, tag.Category)
+	if err != nil || categoryID == "" {
+		return "", err
+	}
+
+	id, err = t.findTagInCategory(ctx, categoryID, tag)
+	if err != nil || id == "" {
+		return "", err
+	}
+
+	t.mu.Lock()
+	t.ids[key] = id
+	t.mu.Unlock()
+	return id, nil
+}
+
+// findTagInCategory returns the ID of tag in the category with categoryID, an
+// empty ID if the tag does not exist
+func (t *Tagger) findTagInCategory(ctx context.Context, categoryID string, tag v1alpha1.Tag) (string, error) {
+	existing, err := t.m.GetTagsForCategory(ctx, categoryID)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not get tags of category %q", tag.Category)
+	}
+
+	for _, e := range existing {
+		if e.Name == tag.Name {
+			return e.ID, nil
+		}
+	}
+	return "", nil
+}
+
+// ensureTag returns the ID of tag, creating the tag and its category if absent
+func (t *Tagger) ensureTag(ctx context.Context, tag v1alpha1.Tag) (string, error) {
+	key := tag.Category + "/" + tag.Name
+
+	t.mu.Lock()
+	id, ok := t.ids[key]
+	t.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	categoryID, err := t.ensureCategory(ctx, tag.Category)
+	if err != nil {
+		return "", err
+	}
+
+	id, err = t.findTagInCategory(ctx, categoryID, tag)
+	if err != nil {
+		return "", err
+	}
+
+	if id == "" {
+		id, err = t.m.CreateTag(ctx, &tags.Tag{
+			Name:        tag.Name,
+			Description: "created by vm-operator",
+			CategoryID:  categoryID,
+		})
+		if err != nil {
+			return "", errors.Wrapf(err, "could not create tag %q", key)
+		}
+	}
+
+	t.mu.Lock()
+	t.ids[key] = id
+	t.mu.Unlock()
+	return id, nil
+}
+
+// findCategory returns the ID of the category name, an empty ID if the
+// category does not exist
+func (t *Tagger) findCategory(ctx context.Context, name string) (string, error) {
+	categories, err := t.m.GetCategories(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "could not get tag categories")
+	}
+
+	for _, c := range categories {
+		if c.Name == name {
+			return c.ID, nil
+		}
+	}
+	return "", nil
+}
+
+func (t *Tagger) ensureCategory(ctx context.Context, name string) (string, error) {
+	id, err := t.findCategory(ctx, name)
+	if err != nil || id != "" {
+		return id, err
+	}
+
+	id, err = t.m.CreateCategory(ctx, &tags.Category{
+		Name:        name,
+		Description: "created by vm-operator",
+		Cardinality: multipleCardinality,
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "could not create tag category %q", name)
+	}
+	return id, nil
+}
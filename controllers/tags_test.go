@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	"codeconnect/operator/api/v1alpha1"
+)
+
+func TestRemovedTags(t *testing.T) {
+	cost := v1alpha1.Tag{Category: "cost-center", Name: "engineering"}
+	env := v1alpha1.Tag{Category: "env", Name: "prod"}
+
+	tests := []struct {
+		name   string
+		status []v1alpha1.Tag
+		spec   []v1alpha1.Tag
+		want   []v1alpha1.Tag
+	}{
+		{
+			name: "no tags",
+		},
+		{
+			name: "added tag",
+			spec: []v1alpha1.Tag{cost},
+		},
+		{
+			name:   "unchanged tags",
+			status: []v1alpha1.Tag{cost, env},
+			spec:   []v1alpha1.Tag{env, cost},
+		},
+		{
+			name:   "removed tag",
+			status: []v1alpha1.Tag{cost, env},
+			spec:   []v1alpha1.Tag{env},
+			want:   []v1alpha1.Tag{cost},
+		},
+		{
+			name:   "all tags removed",
+			status: []v1alpha1.Tag{cost, env},
+			want:   []v1alpha1.Tag{cost, env},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := removedTags(tt.status, tt.spec); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("removedTags() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
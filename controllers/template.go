@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vapi/rest"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"codeconnect/operator/api/v1alpha1"
+)
+
+// extraConfig key used to record the template checksum a replica was built from
+const templateChecksumKey = "vm-operator.template.checksum"
+
+// templateSource is the resolved template replicas are created from, either
+// taken directly from the VmGroup spec or from a referenced VmTemplate
+type templateSource struct {
+	template       string
+	contentLibrary *v1alpha1.ContentLibraryItem
+	version        string // VmTemplate version, empty without templateRef
+	checksum       string // VmTemplate checksum, empty without templateRef
+}
+
+// String returns a human readable name of the source used in logs
+func (s *templateSource) String() string {
+	name := s.template
+	if s.contentLibrary != nil {
+		name = s.contentLibrary.Library + "/" + s.contentLibrary.Item
+	}
+
+	if s.version != "" {
+		return fmt.Sprintf("%s (version %s)", name, s.version)
+	}
+	return name
+}
+
+// options returns the extraConfig recorded on replicas created from this source
+func (s *templateSource) options() []types.BaseOptionValue {
+	if s.checksum == "" {
+		return nil
+	}
+
+	return []types.BaseOptionValue{
+		&types.OptionValue{Key: templateChecksumKey, Value: s.checksum},
+	}
+}
+
+// getTemplateChecksum validates template exists and returns a checksum that
+// changes whenever the template is modified
+func getTemplateChecksum(ctx context.Context, finder *find.Finder, template string) (string, error) {
+	tmpl, err := finder.VirtualMachine(ctx, template)
+	if err != nil {
+		return "", errors.Wrap(err, "could not find template")
+	}
+
+	var vm mo.VirtualMachine
+	err = tmpl.Properties(ctx, tmpl.Reference(), []string{"config.instanceUuid", "config.changeVersion"}, &vm)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not get properties of template %q", template)
+	}
+
+	if vm.Config == nil {
+		return "", errors.Errorf("template %q has no configuration", template)
+	}
+
+	return checksum(vm.Config.InstanceUuid, vm.Config.ChangeVersion), nil
+}
+
+// getLibraryItemChecksum validates the content library item exists and returns
+// a checksum that changes whenever the item content is modified
+func getLibraryItemChecksum(ctx context.Context, rc *rest.Client, ref *v1alpha1.ContentLibraryItem) (string, error) {
+	item, err := getLibraryItem(ctx, rc, ref)
+	if err != nil {
+		return "", err
+	}
+
+	return checksum(item.ID, item.ContentVersion), nil
+}
+
+func checksum(values ...string) string {
+	h := sha256.New()
+	for _, v := range values {
+		h.Write([]byte(v))
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))[:16]
+}
+
+// getOutdatedReplicas returns the vms not built from the template with checksum
+func getOutdatedReplicas(ctx context.Context, vms []*object.VirtualMachine, checksum string) ([]*object.VirtualMachine, error) {
+	if len(vms) == 0 {
+		return nil, nil
+	}
+
+	refs := make([]types.ManagedObjectReference, len(vms))
+	for i, vm := range vms {
+		refs[i] = vm.Reference()
+	}
+
+	var mos []mo.VirtualMachine
+	pc := property.DefaultCollector(vms[0].Client())
+	if err := pc.Retrieve(ctx, refs, []string{"config.extraConfig"}, &mos); err != nil {
+		return nil, errors.Wrap(err, "could not get extraConfig of replicas")
+	}
+
+	current := make(map[types.ManagedObjectReference]bool, len(mos))
+	for _, m := range mos {
+		if m.Config == nil {
+			continue
+		}
+
+		for _, o := range m.Config.ExtraConfig {
+			opt := o.GetOptionValue()
+			if opt.Key == templateChecksumKey && opt.Value == checksum {
+				current[m.Reference()] = true
+			}
+		}
+	}
+
+	var outdated []*object.VirtualMachine
+	for _, vm := range vms {
+		if !current[vm.Reference()] {
+			outdated = append(outdated, vm)
+		}
+	}
+	return outdated, nil
+}
+
+// getTemplateSource resolves the template replicas of vg are created from. If
+// a VmTemplate is referenced, its validated promoted version is used.
+func getTemplateSource(ctx context.Context, c client.Reader, vg *v1alpha1.VmGroup) (*templateSource, error) {
+	if vg.Spec.TemplateRef == nil {
+		return &templateSource{
+			template:       vg.Spec.Template,
+			contentLibrary: vg.Spec.ContentLibrary,
+		}, nil
+	}
+
+	vt := &v1alpha1.VmTemplate{}
+	key := client.ObjectKey{Namespace: vg.Namespace, Name: vg.Spec.TemplateRef.Name}
+	if err := c.Get(ctx, key, vt); err != nil {
+		return nil, errors.Wrapf(err, "could not get VmTemplate %q", key.Name)
+	}
+
+	promoted := vt.Status.PromotedVersion
+	if promoted == "" {
+		return nil, errors.Errorf("VmTemplate %q has no validated version", key.Name)
+	}
+
+	for _, v := range vt.Spec.Versions {
+		if v.Name == promoted {
+			return &templateSource{
+				template:       v.Template,
+				contentLibrary: v.ContentLibrary,
+				version:        v.Name,
+				checksum:       vt.Status.Checksum,
+			}, nil
+		}
+	}
+
+	return nil, errors.Errorf("promoted version %q not found in VmTemplate %q", promoted, key.Name)
+}
+
+// cloneMode returns the mode replicas are cloned from src with, content
+// library items are always deployed as full copies
+func (src *templateSource) cloneMode(spec v1alpha1.VmGroupSpec) v1alpha1.CloneMode {
+	if src.contentLibrary != nil {
+		return v1alpha1.FullCloneMode
+	}
+	return getCloneMode(spec)
+}
@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// statusTimeout bounds status updates, which are not bound by the reconcile
+// timeout
+const statusTimeout = 30 * time.Second
+
+// Timeouts bound vCenter operations. Operations exceeding their timeout are
+// cancelled in vCenter and reported with TimeoutStatusPhase.
+type Timeouts struct {
+	// Reconcile bounds a whole reconcile, including waiting for the limiter
+	Reconcile time.Duration
+	Clone     time.Duration
+	// PowerOn bounds power ons and power offs
+	PowerOn time.Duration
+	Destroy time.Duration
+	// Archive bounds archiving a replica before it is destroyed
+	Archive time.Duration
+	// Snapshot bounds creating, reverting and removing a snapshot of a replica
+	Snapshot time.Duration
+}
+
+// DefaultTimeouts returns the default Timeouts
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		Reconcile: 30 * time.Minute,
+		Clone:     15 * time.Minute,
+		PowerOn:   5 * time.Minute,
+		Destroy:   10 * time.Minute,
+		Archive:   30 * time.Minute,
+		Snapshot:  15 * time.Minute,
+	}
+}
+
+// updateStatus writes the status of obj with its own context so the status is
+// saved after the reconcile timed out
+func updateStatus(c client.StatusClient, obj runtime.Object) error {
+	ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+	defer cancel()
+
+	return errors.Wrap(c.Status().Update(ctx, obj), "could not update status")
+}
+
+// isTimeout returns true if err is caused by an exceeded timeout
+func isTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/object"
+)
+
+// zoneReplicas tracks how the replicas of a VmGroup are distributed across
+// zones. It is used to pick the zone for new replicas and the replica to
+// delete during scale operations.
+type zoneReplicas struct {
+	zones    []*zone
+	replicas map[*zone][]*object.VirtualMachine
+	counts   map[*zone]int32
+	unzoned  []*object.VirtualMachine // not placed in any zone, e.g. after zone removal
+}
+
+func newZoneReplicas(zones []*zone) *zoneReplicas {
+	return &zoneReplicas{
+		zones:    zones,
+		replicas: make(map[*zone][]*object.VirtualMachine, len(zones)),
+		counts:   make(map[*zone]int32, len(zones)),
+	}
+}
+
+// getZoneReplicas assigns vms to zones based on their resource pool
+func getZoneReplicas(ctx context.Context, zones []*zone, vms []*object.VirtualMachine) (*zoneReplicas, error) {
+	zr := newZoneReplicas(zones)
+
+	// no need to ask vCenter if there's only one zone
+	if len(zones) == 1 {
+		zr.replicas[zones[0]] = vms
+		zr.counts[zones[0]] = int32(len(vms))
+		return zr, nil
+	}
+
+	for _, vm := range vms {
+		rp, err := vm.ResourcePool(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not get resource pool for vm %q", vm.Name())
+		}
+
+		var found *zone
+		for _, z := range zones {
+			if z.pool.Reference() == rp.Reference() {
+				found = z
+				break
+			}
+		}
+
+		if found == nil {
+			zr.unzoned = append(zr.unzoned, vm)
+			continue
+		}
+		zr.replicas[found] = append(zr.replicas[found], vm)
+		zr.counts[found]++
+	}
+
+	return zr, nil
+}
+
+// pickCreate returns the zone with the fewest replicas and counts a new
+// replica in it
+func (zr *zoneReplicas) pickCreate() *zone {
+	var fewest *zone
+	for _, z := range zr.zones {
+		if fewest == nil || zr.counts[z] < zr.counts[fewest] {
+			fewest = z
+		}
+	}
+
+	zr.counts[fewest]++
+	return fewest
+}
+
+// pickDelete returns the next replica to delete, preferring replicas outside
+// of any zone, then the zone with the most replicas. Returns nil if there are
+// no replicas left.
+func (zr *zoneReplicas) pickDelete() *object.VirtualMachine {
+	if n := len(zr.unzoned); n > 0 {
+		vm := zr.unzoned[n-1]
+		zr.unzoned = zr.unzoned[:n-1]
+		return vm
+	}
+
+	var most *zone
+	for _, z := range zr.zones {
+		if len(zr.replicas[z]) == 0 {
+			continue
+		}
+		if most == nil || zr.counts[z] > zr.counts[most] {
+			most = z
+		}
+	}
+
+	if most == nil {
+		return nil
+	}
+
+	vms := zr.replicas[most]
+	vm := vms[len(vms)-1]
+	zr.replicas[most] = vms[:len(vms)-1]
+	zr.counts[most]--
+	return vm
+}
+
+// skew returns the difference between the zones with the most and fewest
+// replicas
+func (zr *zoneReplicas) skew() int32 {
+	var fewest, most int32
+	for i, z := range zr.zones {
+		c := zr.counts[z]
+		if i == 0 || c < fewest {
+			fewest = c
+		}
+		if i == 0 || c > most {
+			most = c
+		}
+	}
+	return most - fewest
+}
+
+// balanced returns true if all replicas are placed in a zone and the skew
+// between zones does not exceed maxSkew
+func (zr *zoneReplicas) balanced(maxSkew int32) bool {
+	return len(zr.unzoned) == 0 && zr.skew() <= maxSkew
+}
@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func testVM(name string) *object.VirtualMachine {
+	return object.NewVirtualMachine(nil, types.ManagedObjectReference{Type: "VirtualMachine", Value: name})
+}
+
+// testZoneReplicas returns zone replicas of zones a, b and c with the given
+// replicas by zone name
+func testZoneReplicas(replicas map[string][]string, unzoned ...string) *zoneReplicas {
+	zones := []*zone{{name: "a"}, {name: "b"}, {name: "c"}}
+	zr := newZoneReplicas(zones)
+	for _, z := range zones {
+		for _, name := range replicas[z.name] {
+			zr.replicas[z] = append(zr.replicas[z], testVM(name))
+			zr.counts[z]++
+		}
+	}
+	for _, name := range unzoned {
+		zr.unzoned = append(zr.unzoned, testVM(name))
+	}
+	return zr
+}
+
+func TestPickCreate(t *testing.T) {
+	tests := []struct {
+		name     string
+		replicas map[string][]string
+		want     []string
+	}{
+		{
+			name: "round-robin from empty zones",
+			want: []string{"a", "b", "c", "a"},
+		},
+		{
+			name:     "fills the zone with the fewest replicas",
+			replicas: map[string][]string{"a": {"a1", "a2"}, "c": {"c1"}},
+			want:     []string{"b", "b", "c", "a"},
+		},
+		{
+			name:     "balanced zones",
+			replicas: map[string][]string{"a": {"a1"}, "b": {"b1"}, "c": {"c1"}},
+			want:     []string{"a", "b", "c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zr := testZoneReplicas(tt.replicas)
+
+			var got []string
+			for range tt.want {
+				got = append(got, zr.pickCreate().name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pickCreate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPickDelete(t *testing.T) {
+	tests := []struct {
+		name     string
+		replicas map[string][]string
+		unzoned  []string
+		want     []string
+	}{
+		{
+			name: "no replicas",
+			want: []string{""},
+		},
+		{
+			name:     "unzoned replicas first",
+			replicas: map[string][]string{"a": {"a1"}},
+			unzoned:  []string{"u1", "u2"},
+			want:     []string{"u2", "u1", "a1", ""},
+		},
+		{
+			name:     "zone with the most replicas first",
+			replicas: map[string][]string{"a": {"a1"}, "b": {"b1", "b2", "b3"}, "c": {"c1", "c2"}},
+			want:     []string{"b3", "b2", "c2", "a1", "b1", "c1", ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zr := testZoneReplicas(tt.replicas, tt.unzoned...)
+
+			var got []string
+			for range tt.want {
+				name := ""
+				if vm := zr.pickDelete(); vm != nil {
+					name = vm.Reference().Value
+				}
+				got = append(got, name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pickDelete() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBalanced(t *testing.T) {
+	tests := []struct {
+		name     string
+		replicas map[string][]string
+		unzoned  []string
+		maxSkew  int32
+		want     bool
+	}{
+		{
+			name: "no replicas",
+			want: true,
+		},
+		{
+			name:     "within max skew",
+			replicas: map[string][]string{"a": {"a1", "a2"}, "b": {"b1"}, "c": {"c1"}},
+			maxSkew:  1,
+			want:     true,
+		},
+		{
+			name:     "exceeds max skew",
+			replicas: map[string][]string{"a": {"a1", "a2", "a3"}, "b": {"b1"}, "c": {"c1"}},
+			maxSkew:  1,
+			want:     false,
+		},
+		{
+			name:     "unzoned replicas",
+			replicas: map[string][]string{"a": {"a1"}, "b": {"b1"}, "c": {"c1"}},
+			unzoned:  []string{"u1"},
+			maxSkew:  1,
+			want:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := testZoneReplicas(tt.replicas, tt.unzoned...).balanced(tt.maxSkew); got != tt.want {
+				t.Errorf("balanced() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
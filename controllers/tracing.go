@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/api/global"
+	"go.opentelemetry.io/otel/api/kv"
+	"go.opentelemetry.io/otel/api/trace"
+	export "go.opentelemetry.io/otel/sdk/export/trace"
+	"google.golang.org/grpc/codes"
+)
+
+// TracerName is the name of the tracer used for all spans of the operator
+const TracerName = "codeconnect/operator"
+
+// span attributes
+var (
+	namespaceKey = kv.Key("vmgroup.namespace")
+	nameKey      = kv.Key("vmgroup.name")
+	vmKey        = kv.Key("vcenter.vm")
+	taskKey      = kv.Key("vcenter.task")
+)
+
+// startSpan starts a span with the global trace provider. Spans are no-ops
+// unless a provider is registered, e.g. with an OTLP exporter.
+func startSpan(ctx context.Context, name string, attrs ...kv.KeyValue) (context.Context, trace.Span) {
+	return global.Tracer(TracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends span and records err if not nil
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.SetStatus(codes.Unknown, err.Error())
+	}
+	span.End()
+}
+
+// InMemoryExporter keeps finished spans in memory, e.g. to assert spans in
+// tests. Register it with sdk/trace.WithSyncer.
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []*export.SpanData
+}
+
+var _ export.SpanSyncer = &InMemoryExporter{}
+
+// NewInMemoryExporter returns an empty InMemoryExporter
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+// ExportSpan stores a finished span
+func (e *InMemoryExporter) ExportSpan(_ context.Context, sd *export.SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, sd)
+}
+
+// Spans returns the finished spans in the order they ended
+func (e *InMemoryExporter) Spans() []*export.SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	spans := make([]*export.SpanData, len(e.spans))
+	copy(spans, e.spans)
+	return spans
+}
+
+// Reset removes all stored spans
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
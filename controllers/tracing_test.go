@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/global"
+	"go.opentelemetry.io/otel/api/kv"
+	"go.opentelemetry.io/otel/api/trace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc/codes"
+)
+
+// withInMemoryExporter registers a trace provider exporting all spans to the
+// returned exporter until the returned func is called
+func withInMemoryExporter(t *testing.T) (*InMemoryExporter, func()) {
+	t.Helper()
+
+	exporter := NewInMemoryExporter()
+	tp, err := sdktrace.NewProvider(
+		sdktrace.WithConfig(sdktrace.Config{DefaultSampler: sdktrace.AlwaysSample()}),
+		sdktrace.WithSyncer(exporter),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	global.SetTraceProvider(tp)
+	return exporter, func() { global.SetTraceProvider(trace.NoopProvider{}) }
+}
+
+func attribute(attrs []kv.KeyValue, key kv.Key) string {
+	for _, a := range attrs {
+		if a.Key == key {
+			return a.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestSpans(t *testing.T) {
+	exporter, reset := withInMemoryExporter(t)
+	defer reset()
+
+	tests := []struct {
+		name       string
+		err        error
+		wantCode   codes.Code
+		wantStatus string
+	}{
+		{
+			name:     "success",
+			wantCode: codes.OK,
+		},
+		{
+			name:       "error",
+			err:        errors.New("could not clone vm"),
+			wantCode:   codes.Unknown,
+			wantStatus: "could not clone vm",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter.Reset()
+
+			ctx, parent := startSpan(context.Background(), "reconcile", namespaceKey.String("ns"), nameKey.String("vg"))
+			_, child := startSpan(ctx, "cloneVM", vmKey.String("vg-replica-1"))
+			endSpan(child, tt.err)
+			endSpan(parent, nil)
+
+			spans := exporter.Spans()
+			if len(spans) != 2 {
+				t.Fatalf("got %d spans, want 2", len(spans))
+			}
+
+			clone, reconcile := spans[0], spans[1]
+			if clone.Name != "cloneVM" || reconcile.Name != "reconcile" {
+				t.Errorf("got spans %q, %q, want %q, %q", clone.Name, reconcile.Name, "cloneVM", "reconcile")
+			}
+			if clone.ParentSpanID != reconcile.SpanContext.SpanID {
+				t.Errorf("cloneVM parent = %v, want %v", clone.ParentSpanID, reconcile.SpanContext.SpanID)
+			}
+			if clone.SpanContext.TraceID != reconcile.SpanContext.TraceID {
+				t.Errorf("cloneVM trace = %v, want %v", clone.SpanContext.TraceID, reconcile.SpanContext.TraceID)
+			}
+
+			if got := attribute(reconcile.Attributes, namespaceKey); got != "ns" {
+				t.Errorf("reconcile %s = %q, want %q", namespaceKey, got, "ns")
+			}
+			if got := attribute(reconcile.Attributes, nameKey); got != "vg" {
+				t.Errorf("reconcile %s = %q, want %q", nameKey, got, "vg")
+			}
+			if got := attribute(clone.Attributes, vmKey); got != "vg-replica-1" {
+				t.Errorf("cloneVM %s = %q, want %q", vmKey, got, "vg-replica-1")
+			}
+
+			if clone.StatusCode != tt.wantCode || clone.StatusMessage != tt.wantStatus {
+				t.Errorf("cloneVM status = %v %q, want %v %q", clone.StatusCode, clone.StatusMessage, tt.wantCode, tt.wantStatus)
+			}
+			if reconcile.StatusCode != codes.OK {
+				t.Errorf("reconcile status = %v, want %v", reconcile.StatusCode, codes.OK)
+			}
+		})
+	}
+}
+
+func TestLimiterSpan(t *testing.T) {
+	exporter, reset := withInMemoryExporter(t)
+	defer reset()
+
+	l := NewLimiter(1, 1, 1)
+	if err := l.acquire(context.Background(), cloneOperation, "ns"); err != nil {
+		t.Fatal(err)
+	}
+	l.release(cloneOperation)
+
+	spans := exporter.Spans()
+	if len(spans) != 1 || spans[0].Name != "limiter.acquire" {
+		t.Fatalf("got spans %v, want a single limiter.acquire span", spans)
+	}
+	if got := attribute(spans[0].Attributes, operationKey); got != cloneOperation {
+		t.Errorf("%s = %q, want %q", operationKey, got, cloneOperation)
+	}
+	if got := attribute(spans[0].Attributes, namespaceKey); got != "ns" {
+		t.Errorf("%s = %q, want %q", namespaceKey, got, "ns")
+	}
+}
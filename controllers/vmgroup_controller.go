@@ -27,11 +27,22 @@ import (
 	"github.com/vmware/govmomi"
 	"github.com/vmware/govmomi/find"
 	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vapi/rest"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
 	"golang.org/x/sync/errgroup"
+	corev1 "k8s.io/api/core/v1"
 	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	vmv1alpha1 "codeconnect/operator/api/v1alpha1"
 )
@@ -41,6 +52,22 @@ const (
 	defaultNameLength = 8 // length of generated names
 	defaultRequeue    = 20 * time.Second
 	successMessage    = "successfully reconciled VmGroup"
+	// VmGroupLabel selects the replicas of a VmGroup in the scale subresource,
+	// e.g. for metrics of the VmGroup
+	VmGroupLabel = "vm.codeconnect.vmworld.com/vmgroup"
+)
+
+// event reasons recorded on VmGroups
+const (
+	cloneStartedReason     = "CloneStarted"
+	cloneFailedReason      = "CloneFailed"
+	replicaDeletedReason   = "ReplicaDeleted"
+	poweredOnReason        = "PoweredOn"
+	poweredOffReason       = "PoweredOff"
+	folderCreatedReason    = "FolderCreated"
+	replicaAdoptedReason   = "ReplicaAdopted"
+	replicaArchivedReason  = "ReplicaArchived"
+	templateNotFoundReason = "TemplateNotFound"
 )
 
 var (
@@ -50,18 +77,42 @@ var (
 // VmGroupReconciler reconciles a VmGroup object
 type VmGroupReconciler struct {
 	client.Client
+	// APIReader reads Services, Endpoints and EndpointSlices, the manager
+	// cache would hold all of them in the cluster
+	APIReader    client.Reader
 	Finder       *find.Finder
 	ResourcePool *object.ResourcePool
 	VC           *govmomi.Client // owns vCenter connection
-	Log          logr.Logger
-	Scheme       *runtime.Scheme
+	Rest         *rest.Client    // vCenter REST API, e.g. content library
+	Recorder     record.EventRecorder
+	Limiter      *Limiter // shared by all reconciles
+	Timeouts     Timeouts
+	// MaxConcurrentReconciles is the number of VmGroups reconciled in
+	// parallel, operations against vCenter are bounded by the Limiter
+	MaxConcurrentReconciles int
+	Context                 context.Context // cancelled on shutdown
+	Paused                  bool            // pause changes to all VmGroups
+	Tagger                  *Tagger
+	Log                     logr.Logger
+	Scheme                  *runtime.Scheme
 }
 
 // +kubebuilder:rbac:groups=vm.codeconnect.vmworld.com,resources=vmgroups,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=vm.codeconnect.vmworld.com,resources=vmgroups/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=vm.codeconnect.vmworld.com,resources=vmtemplates,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get
+// +kubebuilder:rbac:groups="",resources=services;endpoints,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=discovery.k8s.io,resources=endpointslices,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=vm.codeconnect.vmworld.com,resources=vmnamespaceconfigs,verbs=get;list;watch
+// +kubebuilder:rbac:groups=vm.codeconnect.vmworld.com,resources=vmquotas,verbs=get;list;watch
 
 func (r *VmGroupReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
-	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(r.Context, r.Timeouts.Reconcile)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "VmGroup.Reconcile", namespaceKey.String(req.Namespace), nameKey.String(req.Name))
+	defer span.End()
 	log := r.Log.WithValues("vmgroup", req.NamespacedName)
 
 	vg := &vmv1alpha1.VmGroup{}
@@ -84,6 +135,11 @@ func (r *VmGroupReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		log.Info("VmGroup marked for deletion")
 		// The object is being deleted
 		if containsString(vg.ObjectMeta.Finalizers, finalizerID) {
+			if r.paused(vg) {
+				log.Info("VmGroup paused, deferring deletion of replicas")
+				return ctrl.Result{RequeueAfter: defaultRequeue}, nil
+			}
+
 			// our finalizer is present, so lets handle any external dependency
 			if err := r.deleteExternalResources(ctx, r.Finder, vg); err != nil {
 				// if fail to delete the external dependency here, return with error
@@ -96,6 +152,7 @@ func (r *VmGroupReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 			if err := r.Update(ctx, vg); err != nil {
 				return ctrl.Result{}, errors.Wrap(err, "could not remove finalizer")
 			}
+			deleteReplicaMetrics(vg.Namespace, vg.Name)
 		}
 		// finalizer already removed, nothing to do
 		return ctrl.Result{}, nil
@@ -113,8 +170,87 @@ func (r *VmGroupReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	var nfe *find.NotFoundError
 	desired := vg.Spec.Replicas
 
+	if countSet(vg.Spec.Template != "", vg.Spec.ContentLibrary != nil, vg.Spec.TemplateRef != nil) != 1 {
+		msg := "invalid VmGroup spec"
+		err := errors.New("exactly one of template, contentLibrary or templateRef must be set")
+		log.Error(err, msg)
+
+		vg.Status = createStatus(vg, vmv1alpha1.ErrorStatusPhase, msg, err, nil, desired)
+
+		// ignoring this VmGroup until the spec is fixed
+		return ctrl.Result{}, updateStatus(r.Client, vg)
+	}
+
+	// isolated namespaces have their own folder and resource pool
+	nc, err := getNamespaceConfig(ctx, r.Client, vg.Namespace)
+	if err != nil {
+		msg := "could not get namespace config"
+		log.Error(err, msg)
+
+		vg.Status = createStatus(vg, vmv1alpha1.PendingStatusPhase, msg, err, nil, desired)
+		return ctrl.Result{RequeueAfter: defaultRequeue}, updateStatus(r.Client, vg)
+	}
+
+	if nc != nil && nc.Status.Phase != vmv1alpha1.RunningStatusPhase {
+		msg := "waiting for namespace folder and resource pool"
+		err := errors.Errorf("VmNamespaceConfig %q is not ready", nc.Name)
+		log.Info(msg, "reason", err.Error())
+
+		vg.Status = createStatus(vg, vmv1alpha1.PendingStatusPhase, msg, err, nil, desired)
+		return ctrl.Result{RequeueAfter: defaultRequeue}, updateStatus(r.Client, vg)
+	}
+
+	if err = validateNamespaceSpec(nc, vg.Spec); err != nil {
+		msg := "VmGroup spec not allowed in namespace"
+		log.Error(err, msg)
+
+		vg.Status = createStatus(vg, vmv1alpha1.ErrorStatusPhase, msg, err, nil, desired)
+
+		// ignoring this VmGroup until the spec or the VmNamespaceConfig is fixed
+		return ctrl.Result{}, updateStatus(r.Client, vg)
+	}
+
+	// resolve where replicas are placed in vCenter
+	pl, err := resolvePlacement(ctx, r.Finder, r.ResourcePool, vg, nc)
+	if err != nil {
+		msg := "could not resolve placement for VmGroup"
+		log.Error(err, msg)
+
+		vg.Status = createStatus(vg, vmv1alpha1.ErrorStatusPhase, msg, err, nil, desired)
+
+		// ignoring this VmGroup until placement is fixed in the spec
+		return ctrl.Result{}, updateStatus(r.Client, vg)
+	}
+
+	if r.paused(vg) {
+		return r.refreshPausedStatus(ctx, pl, vg)
+	}
+
+	// resolve the template replicas are created from
+	src, err := getTemplateSource(ctx, r.Client, vg)
+	if err != nil {
+		msg := "could not resolve template for VmGroup"
+		log.Error(err, msg)
+		r.Recorder.Event(vg, corev1.EventTypeWarning, templateNotFoundReason, err.Error())
+
+		vg.Status = createStatus(vg, vmv1alpha1.PendingStatusPhase, msg, err, nil, desired)
+
+		// VmTemplate might not be created or validated yet
+		return ctrl.Result{RequeueAfter: defaultRequeue}, updateStatus(r.Client, vg)
+	}
+
+	if err = templateAllowed(nc, src); err != nil {
+		msg := "VmGroup template not allowed in namespace"
+		log.Error(err, msg)
+
+		vg.Status = createStatus(vg, vmv1alpha1.ErrorStatusPhase, msg, err, nil, desired)
+
+		// ignoring this VmGroup until the spec or the VmNamespaceConfig is fixed
+		return ctrl.Result{}, updateStatus(r.Client, vg)
+	}
+
 	// check if VmGroup folder exists
-	_, err := getVMGroup(ctx, r.Finder, getGroupName(vg.Namespace, vg.Name))
+	_, err = getVMGroup(ctx, r.Finder, pl.folder, getGroupName(vg.Namespace, vg.Name))
 	exists := true
 	if err != nil {
 		// standard type cast does not work since it's a wrapped error
@@ -126,44 +262,111 @@ func (r *VmGroupReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 			msg := "could not get VmGroup from vCenter"
 			log.Error(err, msg)
 
-			vg.Status = createStatus(vmv1alpha1.ErrorStatusPhase, msg, err, nil, desired)
+			vg.Status = createStatus(vg, vmv1alpha1.ErrorStatusPhase, msg, err, nil, desired)
 
 			// ignoring this VmGroup in the future due to unknown error
-			return ctrl.Result{}, errors.Wrap(r.Client.Status().Update(ctx, vg), "could not update status")
+			return ctrl.Result{}, updateStatus(r.Client, vg)
 		}
 	}
 
 	// create VmGroup folder
 	if !exists {
 		log.Info("creating VmGroup in vCenter")
-		_, err = createVMGroup(ctx, r.Finder, getGroupName(vg.Namespace, vg.Name))
+		_, err = createVMGroup(ctx, r.Finder, pl.folder, getGroupName(vg.Namespace, vg.Name))
 		if err != nil {
 			// TODO: go fancy with error handling to decide whether error is permanent or temporary
 			msg := "could not create VmGroup in vCenter"
 			log.Error(err, msg)
 
-			vg.Status = createStatus(vmv1alpha1.ErrorStatusPhase, msg, err, nil, desired)
+			vg.Status = createStatus(vg, vmv1alpha1.ErrorStatusPhase, msg, err, nil, desired)
 
 			// ignoring this VmGroup in the future due to unknown error
-			return ctrl.Result{}, errors.Wrap(r.Client.Status().Update(ctx, vg), "could not update status")
+			return ctrl.Result{}, updateStatus(r.Client, vg)
 		}
+		r.Recorder.Eventf(vg, corev1.EventTypeNormal, folderCreatedReason, "Created folder %q", pl.folder+"/"+getGroupName(vg.Namespace, vg.Name))
 		exists = true
 	}
 
+	// the group folder is never moved, later placement changes only apply to
+	// new groups
+	vg.Status.Folder = pl.folder
+
 	// get replicas (VMs) for VmGroup
-	vms, err := getReplicas(ctx, r.Finder, getGroupName(vg.Namespace, vg.Name))
+	or, err := r.getOwnedReplicas(ctx, pl.folder, vg)
 	if err != nil {
 		if errors.As(err, &nfe) {
 			exists = false
+			or = &ownedReplicas{}
 		} else {
 			// TODO: go fancy with error handling to decide whether error is permanent or temporary
 			msg := "could not get replicas for VmGroup from vCenter"
 			log.Error(err, msg)
 
-			vg.Status = createStatus(vmv1alpha1.ErrorStatusPhase, msg, err, nil, desired)
+			vg.Status = createStatus(vg, vmv1alpha1.ErrorStatusPhase, msg, err, nil, desired)
 
 			// ignoring this VmGroup in the future due to unknown error
-			return ctrl.Result{}, errors.Wrap(r.Client.Status().Update(ctx, vg), "could not update status")
+			return ctrl.Result{}, updateStatus(r.Client, vg)
+		}
+	}
+
+	adopt, unowned := or.adoptable(vg)
+
+	for _, vm := range adopt {
+		msg := fmt.Sprintf("adopting vm %q", vm.Name())
+		log.Info(msg)
+
+		if err = setOwner(ctx, vm, string(vg.UID)); err != nil {
+			msg := "could not adopt replica"
+			log.Error(err, msg)
+
+			vg.Status = createStatus(vg, vmv1alpha1.PendingStatusPhase, msg, err, nil, desired)
+			return ctrl.Result{RequeueAfter: defaultRequeue}, updateStatus(r.Client, vg)
+		}
+		r.Recorder.Eventf(vg, corev1.EventTypeNormal, replicaAdoptedReason, "Adopted vm %q", vm.Name())
+	}
+	or.owned = append(or.owned, adopt...)
+	or.unowned = unowned
+
+	// VMs not owned by this VmGroup are never touched
+	vms := or.owned
+	ignored := vmNames(or.ignored())
+	if len(ignored) > 0 {
+		log.Info("ignoring VMs not owned by VmGroup", "vms", ignored)
+	}
+	if len(vms) == 0 {
+		exists = false
+	}
+
+	// scale-ups are capped by the VmQuotas of the namespace
+	desired, err = r.applyQuotas(ctx, vg, src, int32(len(vms)), desired)
+	if err != nil {
+		msg := "could not apply quotas"
+		log.Error(err, msg)
+
+		vg.Status = createStatus(vg, vmv1alpha1.PendingStatusPhase, msg, err, nil, vg.Spec.Replicas)
+		return ctrl.Result{RequeueAfter: defaultRequeue}, updateStatus(r.Client, vg)
+	}
+
+	if desired < vg.Spec.Replicas {
+		log.Info(getCondition(vg.Status.Conditions, vmv1alpha1.QuotaExceededCondition).Message)
+	}
+
+	// linked clones are created from a template snapshot
+	if src.contentLibrary == nil && getCloneMode(vg.Spec) == vmv1alpha1.LinkedCloneMode {
+		err = ensureTemplateSnapshot(ctx, r.Finder, src.template, getTemplateSnapshot(vg.Spec))
+		if err != nil {
+			msg := "could not prepare template for linked clones"
+			log.Error(err, msg)
+
+			if errors.As(err, &nfe) {
+				r.Recorder.Event(vg, corev1.EventTypeWarning, templateNotFoundReason, err.Error())
+				vg.Status = createStatus(vg, vmv1alpha1.ErrorStatusPhase, msg, err, nil, desired)
+				// ignoring in the future due to permanent error
+				return ctrl.Result{}, updateStatus(r.Client, vg)
+			}
+
+			vg.Status = createStatus(vg, vmv1alpha1.PendingStatusPhase, msg, err, nil, desired)
+			return ctrl.Result{RequeueAfter: defaultRequeue}, updateStatus(r.Client, vg)
 		}
 	}
 
@@ -172,22 +375,25 @@ func (r *VmGroupReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	// create replicas (VMs)
 	if !exists {
 		msg := fmt.Sprintf("no VMs found for VmGroup, creating %d replica(s)", desired)
+		if desired == 0 {
+			msg = "no VMs found for VmGroup, scaled to zero"
+		}
 		log.Info(msg)
 
-		lim := newLimiter(defaultConcurrency)
+		zr := newZoneReplicas(pl.zones)
 
 		// TODO: process async and return early
 		for i := 0; i < int(desired); i++ {
-			lim.acquire()
 			vmName := fmt.Sprintf("%s-replica-%s", vg.Name, generateName())
-			msg := fmt.Sprintf("creating clone %q from template %q", vmName, vg.Spec.Template)
+			msg := fmt.Sprintf("creating clone %q from template %q", vmName, src)
 			log.Info(msg)
 
-			groupPath := vmPath + "/" + getGroupName(vg.Namespace, vg.Name)
+			groupPath := pl.folder + "/" + getGroupName(vg.Namespace, vg.Name)
+			host := pl.host(i)
+			z := zr.pickCreate()
 
 			eg.Go(func() error {
-				defer lim.release()
-				return cloneVM(egCtx, r.Finder, vg.Spec.Template, vmName, groupPath, r.ResourcePool, vg.Spec)
+				return r.cloneReplica(egCtx, vg, src, vmName, groupPath, z, host)
 			})
 		}
 
@@ -197,27 +403,66 @@ func (r *VmGroupReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 			log.Error(err, msg)
 
 			if errors.As(err, &nfe) {
-				vg.Status = createStatus(vmv1alpha1.ErrorStatusPhase, msg, err, nil, desired)
+				vg.Status = createStatus(vg, vmv1alpha1.ErrorStatusPhase, msg, err, nil, desired)
 				// ignoring in the future due to permanent error
-				return ctrl.Result{}, errors.Wrap(r.Client.Status().Update(ctx, vg), "could not update status")
+				return ctrl.Result{}, updateStatus(r.Client, vg)
 			}
 
 			// TODO: be smarter about how we calculate "current" count
-			vg.Status = createStatus(vmv1alpha1.PendingStatusPhase, msg, err, nil, desired)
+			vg.Status = createStatus(vg, vmv1alpha1.PendingStatusPhase, msg, err, nil, desired)
 			// retry after some time
-			return ctrl.Result{RequeueAfter: defaultRequeue}, errors.Wrap(r.Client.Status().Update(ctx, vg), "could not update status")
+			return ctrl.Result{RequeueAfter: defaultRequeue}, updateStatus(r.Client, vg)
+		}
+
+		if err = r.syncAntiAffinity(ctx, pl, vg); err != nil {
+			msg := "could not update anti-affinity rule"
+			log.Error(err, msg)
+
+			vg.Status = createStatus(vg, vmv1alpha1.PendingStatusPhase, msg, err, &desired, desired)
+			return ctrl.Result{RequeueAfter: defaultRequeue}, updateStatus(r.Client, vg)
+		}
+
+		if err = r.syncTags(ctx, pl, vg); err != nil {
+			msg := "could not update tags"
+			log.Error(err, msg)
+
+			vg.Status = createStatus(vg, vmv1alpha1.PendingStatusPhase, msg, err, &desired, desired)
+			return ctrl.Result{RequeueAfter: defaultRequeue}, updateStatus(r.Client, vg)
 		}
 
-		status := createStatus(vmv1alpha1.RunningStatusPhase, successMessage, nil, &desired, desired)
+		if err = r.syncService(ctx, pl, vg); err != nil {
+			msg := "could not update service"
+			log.Error(err, msg)
+
+			vg.Status = createStatus(vg, vmv1alpha1.PendingStatusPhase, msg, err, &desired, desired)
+			return ctrl.Result{RequeueAfter: defaultRequeue}, updateStatus(r.Client, vg)
+		}
+
+		ready := r.recordReplicas(ctx, pl, vg)
+
+		status := createStatus(vg, runningPhase(vg.Spec), successMessage, nil, &desired, desired)
+		status.CloneMode = src.cloneMode(vg.Spec)
+		status.TemplateVersion = src.version
+		status.IgnoredVMs = ignored
+		status.ReadyReplicas = ready
 		vg.Status = status
 
 		// we're done, return successfully
-		return ctrl.Result{}, errors.Wrap(r.Client.Status().Update(ctx, vg), "could not update status")
+		return readinessResult(ctrl.Result{}, ready, vg.Spec), updateStatus(r.Client, vg)
 	}
 
 	// reaching here means (some) replicas exist, checking for diffs
 	current := int32(len(vms))
-	lim := newLimiter(defaultConcurrency)
+	result := ctrl.Result{}
+
+	zr, err := getZoneReplicas(ctx, pl.zones, vms)
+	if err != nil {
+		msg := "could not get zones for replicas"
+		log.Error(err, msg)
+
+		vg.Status = createStatus(vg, vmv1alpha1.PendingStatusPhase, msg, err, &current, desired)
+		return ctrl.Result{RequeueAfter: defaultRequeue}, updateStatus(r.Client, vg)
+	}
 
 	switch {
 	case current < desired:
@@ -226,17 +471,16 @@ func (r *VmGroupReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		log.Info(msg)
 
 		for i := 0; i < int(diff); i++ {
-			lim.acquire()
-
 			vmName := fmt.Sprintf("%s-replica-%s", vg.Name, generateName())
 			msg := fmt.Sprintf("creating virtual machine %q", vmName)
 			log.Info(msg)
 
-			groupPath := vmPath + "/" + getGroupName(vg.Namespace, vg.Name)
+			groupPath := pl.folder + "/" + getGroupName(vg.Namespace, vg.Name)
+			host := pl.host(int(current) + i)
+			z := zr.pickCreate()
 
 			eg.Go(func() error {
-				defer lim.release()
-				return cloneVM(egCtx, r.Finder, vg.Spec.Template, vmName, groupPath, r.ResourcePool, vg.Spec)
+				return r.cloneReplica(egCtx, vg, src, vmName, groupPath, z, host)
 			})
 		}
 
@@ -246,16 +490,36 @@ func (r *VmGroupReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 			log.Error(err, msg)
 
 			if errors.As(err, &nfe) {
-				vg.Status = createStatus(vmv1alpha1.ErrorStatusPhase, msg, err, &current, desired)
+				vg.Status = createStatus(vg, vmv1alpha1.ErrorStatusPhase, msg, err, &current, desired)
 
 				// ignoring in the future due to permanent error
-				return ctrl.Result{}, errors.Wrap(r.Client.Status().Update(ctx, vg), "could not update status")
+				return ctrl.Result{}, updateStatus(r.Client, vg)
 			}
 
-			status := createStatus(vmv1alpha1.PendingStatusPhase, msg, err, &current, desired)
+			status := createStatus(vg, vmv1alpha1.PendingStatusPhase, msg, err, &current, desired)
 			vg.Status = status
 
-			return ctrl.Result{RequeueAfter: defaultRequeue}, errors.Wrap(r.Client.Status().Update(ctx, vg), "could not update status")
+			return ctrl.Result{RequeueAfter: defaultRequeue}, updateStatus(r.Client, vg)
+		}
+
+	case desired == 0 && getScaleToZeroPolicy(vg.Spec) == vmv1alpha1.PowerOffScaleToZeroPolicy:
+		msg := fmt.Sprintf("VmGroup scaled to zero, powering off %d replica(s)", current)
+		log.Info(msg)
+
+		for i := 0; i < len(vms); i++ {
+			vm := vms[i]
+			eg.Go(func() error {
+				return r.powerOffReplica(egCtx, vg, vm)
+			})
+		}
+
+		err = eg.Wait()
+		if err != nil {
+			msg := "could not power off replica(s)"
+			log.Error(err, msg)
+
+			vg.Status = createStatus(vg, vmv1alpha1.PendingStatusPhase, msg, err, &current, desired)
+			return ctrl.Result{RequeueAfter: defaultRequeue}, updateStatus(r.Client, vg)
 		}
 
 	case current > desired:
@@ -264,15 +528,12 @@ func (r *VmGroupReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		log.Info(msg)
 
 		for i := 0; i < int(diff); i++ {
-			lim.acquire()
-
-			vm := vms[i]
+			vm := zr.pickDelete()
 			msg := fmt.Sprintf("deleting virtual machine %q", vm.Name())
 			log.Info(msg)
 
 			eg.Go(func() error {
-				defer lim.release()
-				return deleteVM(egCtx, vm)
+				return r.deleteReplica(egCtx, vg, vm)
 			})
 		}
 
@@ -281,11 +542,11 @@ func (r *VmGroupReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 			msg := "could not delete replica(s)"
 			log.Error(err, msg)
 
-			status := createStatus(vmv1alpha1.PendingStatusPhase, msg, err, &current, desired)
+			status := createStatus(vg, vmv1alpha1.PendingStatusPhase, msg, err, &current, desired)
 			status.CurrentReplicas = &current
 			vg.Status = status
 
-			return ctrl.Result{RequeueAfter: defaultRequeue}, errors.Wrap(r.Client.Status().Update(ctx, vg), "could not update status")
+			return ctrl.Result{RequeueAfter: defaultRequeue}, updateStatus(r.Client, vg)
 		}
 
 	default:
@@ -297,79 +558,635 @@ func (r *VmGroupReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 				msg := fmt.Sprintf("could not get power state for vm %q", vm.Name())
 				log.Error(err, msg)
 
-				status := createStatus(vmv1alpha1.PendingStatusPhase, msg, err, &current, desired)
+				status := createStatus(vg, vmv1alpha1.PendingStatusPhase, msg, err, &current, desired)
 				status.CurrentReplicas = &current
 				vg.Status = status
 
-				return ctrl.Result{RequeueAfter: defaultRequeue}, errors.Wrap(r.Client.Status().Update(ctx, vg), "could not update status")
+				return ctrl.Result{RequeueAfter: defaultRequeue}, updateStatus(r.Client, vg)
 			}
 
-			if !on {
+			switch powerState := getPowerState(vg.Spec); {
+			case !on && powerState == vmv1alpha1.PoweredOnPowerState:
 				eg.Go(func() error {
-					lim.acquire()
-					defer lim.release()
 					msg := fmt.Sprintf("vm %q powered off, attempting to power on...", vm.Name())
 					log.Info(msg)
 
-					task, err := vm.PowerOn(egCtx)
-					if err != nil {
-						return err
-					}
+					return r.powerOnReplica(egCtx, vg, vm)
+				})
+			case on && powerState == vmv1alpha1.PoweredOffPowerState:
+				eg.Go(func() error {
+					msg := fmt.Sprintf("vm %q powered on, attempting to power off...", vm.Name())
+					log.Info(msg)
 
-					return task.Wait(egCtx)
+					return r.powerOffReplica(egCtx, vg, vm)
 				})
 			}
 		}
 
 		err = eg.Wait()
 		if err != nil {
-			msg := "could not power on virtual machine"
+			msg := "could not change power state of virtual machine"
 			log.Error(err, msg)
 
-			status := createStatus(vmv1alpha1.PendingStatusPhase, msg, err, &current, desired)
+			status := createStatus(vg, vmv1alpha1.PendingStatusPhase, msg, err, &current, desired)
 			status.CurrentReplicas = &current
 			vg.Status = status
 
-			return ctrl.Result{RequeueAfter: defaultRequeue}, errors.Wrap(r.Client.Status().Update(ctx, vg), "could not update status")
+			return ctrl.Result{RequeueAfter: defaultRequeue}, updateStatus(r.Client, vg)
 		}
+
+		// replace replicas built from an older template version one at a time
+		if src.checksum != "" {
+			outdated, err := getOutdatedReplicas(ctx, vms, src.checksum)
+			if err != nil {
+				msg := "could not get template version of replicas"
+				log.Error(err, msg)
+
+				vg.Status = createStatus(vg, vmv1alpha1.PendingStatusPhase, msg, err, &current, desired)
+				return ctrl.Result{RequeueAfter: defaultRequeue}, updateStatus(r.Client, vg)
+			}
+
+			if len(outdated) > 0 {
+				vm := outdated[0]
+				z := zr.pickCreate()
+
+				vmName := fmt.Sprintf("%s-replica-%s", vg.Name, generateName())
+				msg := fmt.Sprintf("rolling out template %s, replacing %q with %q (%d outdated replica(s))", src, vm.Name(), vmName, len(outdated))
+				log.Info(msg)
+
+				// the replacement takes the host slot of the replaced replica
+				groupPath := pl.folder + "/" + getGroupName(vg.Namespace, vg.Name)
+				host := pl.host(replicaIndex(vms, vm))
+				err = r.cloneReplica(ctx, vg, src, vmName, groupPath, z, host)
+				if err == nil {
+					err = r.deleteReplica(ctx, vg, vm)
+				}
+
+				if err != nil {
+					msg := "could not roll out template version"
+					log.Error(err, msg)
+
+					vg.Status = createStatus(vg, vmv1alpha1.PendingStatusPhase, msg, err, &current, desired)
+					return ctrl.Result{RequeueAfter: defaultRequeue}, updateStatus(r.Client, vg)
+				}
+
+				// continue with the next replica, anti-affinity is synced once all are replaced
+				vg.Status = createStatus(vg, vmv1alpha1.PendingStatusPhase, msg, nil, &current, desired)
+				return ctrl.Result{RequeueAfter: defaultRequeue}, updateStatus(r.Client, vg)
+			}
+		}
+
+		// move one replica at a time to keep the group available
+		if pl.spread() && !zr.balanced(pl.maxSkew) {
+			z := zr.pickCreate()
+			vm := zr.pickDelete()
+
+			vmName := fmt.Sprintf("%s-replica-%s", vg.Name, generateName())
+			msg := fmt.Sprintf("replicas not balanced across zones, moving %q to %q in zone %q", vm.Name(), vmName, z.name)
+			log.Info(msg)
+
+			groupPath := pl.folder + "/" + getGroupName(vg.Namespace, vg.Name)
+			host := pl.host(replicaIndex(vms, vm))
+			err = r.cloneReplica(ctx, vg, src, vmName, groupPath, z, host)
+			if err == nil {
+				err = r.deleteReplica(ctx, vg, vm)
+			}
+
+			if err != nil {
+				msg := "could not rebalance replicas across zones"
+				log.Error(err, msg)
+
+				vg.Status = createStatus(vg, vmv1alpha1.PendingStatusPhase, msg, err, &current, desired)
+				return ctrl.Result{RequeueAfter: defaultRequeue}, updateStatus(r.Client, vg)
+			}
+
+			if !zr.balanced(pl.maxSkew) {
+				result.RequeueAfter = defaultRequeue
+			}
+		}
+	}
+
+	if err = r.syncAntiAffinity(ctx, pl, vg); err != nil {
+		msg := "could not update anti-affinity rule"
+		log.Error(err, msg)
+
+		vg.Status = createStatus(vg, vmv1alpha1.PendingStatusPhase, msg, err, &current, desired)
+		return ctrl.Result{RequeueAfter: defaultRequeue}, updateStatus(r.Client, vg)
 	}
 
-	status := createStatus(vmv1alpha1.RunningStatusPhase, successMessage, nil, &current, desired)
+	if err = r.syncTags(ctx, pl, vg); err != nil {
+		msg := "could not update tags"
+		log.Error(err, msg)
+
+		vg.Status = createStatus(vg, vmv1alpha1.PendingStatusPhase, msg, err, &current, desired)
+		return ctrl.Result{RequeueAfter: defaultRequeue}, updateStatus(r.Client, vg)
+	}
+
+	if err = r.syncService(ctx, pl, vg); err != nil {
+		msg := "could not update service"
+		log.Error(err, msg)
+
+		vg.Status = createStatus(vg, vmv1alpha1.PendingStatusPhase, msg, err, &current, desired)
+		return ctrl.Result{RequeueAfter: defaultRequeue}, updateStatus(r.Client, vg)
+	}
+
+	ready := r.recordReplicas(ctx, pl, vg)
+
+	status := createStatus(vg, runningPhase(vg.Spec), successMessage, nil, &current, desired)
+	status.CloneMode = src.cloneMode(vg.Spec)
+	status.TemplateVersion = src.version
+	status.IgnoredVMs = ignored
+	status.ReadyReplicas = ready
 	vg.Status = status
 
 	// we're done, return successfully
-	return ctrl.Result{}, errors.Wrap(r.Client.Status().Update(ctx, vg), "could not update status")
+	return readinessResult(result, ready, vg.Spec), updateStatus(r.Client, vg)
+}
+
+// cloneReplica creates the replica name in destination and records events on
+// the VmGroup
+func (r *VmGroupReconciler) cloneReplica(ctx context.Context, vg *vmv1alpha1.VmGroup, src *templateSource, name, destination string, z *zone, host *object.HostSystem) error {
+	if err := r.Limiter.acquire(ctx, cloneOperation, vg.Namespace); err != nil {
+		return err
+	}
+	defer r.Limiter.release(cloneOperation)
+
+	ctx, cancel := context.WithTimeout(ctx, r.Timeouts.Clone)
+	defer cancel()
+
+	r.Recorder.Eventf(vg, corev1.EventTypeNormal, cloneStartedReason, "Creating replica %q from template %s", name, src)
+
+	err := cloneVM(ctx, r.Finder, r.Rest, src, name, destination, z, host, vg.Spec)
+	var de *deployedError
+	if errors.As(err, &de) {
+		// a replica deployed from a content library item but not configured
+		// is not marked as owned and would leak
+		err = r.deleteUnmarked(de.vm, err)
+	} else if err == nil {
+		err = r.markOwner(ctx, vg, destination+"/"+name)
+	}
+
+	if err != nil {
+		r.Recorder.Eventf(vg, corev1.EventTypeWarning, cloneFailedReason, "Could not create replica %q: %v", name, err)
+		return err
+	}
+	return nil
+}
+
+// markOwner marks the vm at path as replica of vg
+func (r *VmGroupReconciler) markOwner(ctx context.Context, vg *vmv1alpha1.VmGroup, path string) error {
+	vm, err := r.Finder.VirtualMachine(ctx, path)
+	if err != nil {
+		return errors.Wrapf(err, "could not find replica %q", path)
+	}
+
+	if err = setOwner(ctx, vm, string(vg.UID)); err != nil {
+		// an unmarked clone would be replaced on the next reconcile and leak
+		return r.deleteUnmarked(vm, err)
+	}
+	return nil
+}
+
+// deleteUnmarked deletes the replica vm not marked as owned after it failed
+// with err and returns err. The clone context may already be expired.
+func (r *VmGroupReconciler) deleteUnmarked(vm *object.VirtualMachine, err error) error {
+	dctx, cancel := context.WithTimeout(r.Context, r.Timeouts.Destroy)
+	defer cancel()
+	if derr := deleteVM(dctx, vm); derr != nil {
+		return errors.Wrapf(err, "could not delete unmarked replica %q: %v", vm.InventoryPath, derr)
+	}
+	return err
+}
+
+// deleteReplica deletes vm and records an event on the VmGroup
+func (r *VmGroupReconciler) deleteReplica(ctx context.Context, vg *vmv1alpha1.VmGroup, vm *object.VirtualMachine) error {
+	if vg.Spec.Archive != nil {
+		kept, err := r.archiveReplica(ctx, vg, vm)
+		if err != nil || kept {
+			return err
+		}
+	}
+
+	if err := r.Limiter.acquire(ctx, destroyOperation, vg.Namespace); err != nil {
+		return err
+	}
+	defer r.Limiter.release(destroyOperation)
+
+	ctx, cancel := context.WithTimeout(ctx, r.Timeouts.Destroy)
+	defer cancel()
+
+	if err := deleteVM(ctx, vm); err != nil {
+		return err
+	}
+
+	r.Recorder.Eventf(vg, corev1.EventTypeNormal, replicaDeletedReason, "Deleted replica %q", vm.Name())
+	return nil
+}
+
+// archiveReplica archives vm before it is deleted. Returns true if vm was kept
+// as archive. Archives copying the replica have the budget of clones.
+func (r *VmGroupReconciler) archiveReplica(ctx context.Context, vg *vmv1alpha1.VmGroup, vm *object.VirtualMachine) (bool, error) {
+	if vg.Spec.Archive.Mode != vmv1alpha1.TemplateArchiveMode {
+		if err := r.Limiter.acquire(ctx, cloneOperation, vg.Namespace); err != nil {
+			return false, err
+		}
+		defer r.Limiter.release(cloneOperation)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.Timeouts.Archive)
+	defer cancel()
+
+	name := vm.Name()
+	kept, err := archiveVM(ctx, r.Finder, vg.Spec.Archive, getGroupName(vg.Namespace, vg.Name), vm)
+	if err != nil {
+		return false, errors.Wrapf(err, "could not archive replica %q", name)
+	}
+
+	r.Recorder.Eventf(vg, corev1.EventTypeNormal, replicaArchivedReason, "Archived replica %q (%s)", name, vg.Spec.Archive.Mode)
+	return kept, nil
+}
+
+// powerOnReplica powers on vm and records an event on the VmGroup
+func (r *VmGroupReconciler) powerOnReplica(ctx context.Context, vg *vmv1alpha1.VmGroup, vm *object.VirtualMachine) error {
+	if err := r.Limiter.acquire(ctx, powerOnOperation, vg.Namespace); err != nil {
+		return err
+	}
+	defer r.Limiter.release(powerOnOperation)
+
+	ctx, cancel := context.WithTimeout(ctx, r.Timeouts.PowerOn)
+	defer cancel()
+
+	if err := powerOnVM(ctx, vm); err != nil {
+		return err
+	}
+
+	r.Recorder.Eventf(vg, corev1.EventTypeNormal, poweredOnReason, "Powered on replica %q", vm.Name())
+	return nil
+}
+
+// powerOffReplica powers off vm and records an event on the VmGroup
+func (r *VmGroupReconciler) powerOffReplica(ctx context.Context, vg *vmv1alpha1.VmGroup, vm *object.VirtualMachine) error {
+	if err := r.Limiter.acquire(ctx, powerOffOperation, vg.Namespace); err != nil {
+		return err
+	}
+	defer r.Limiter.release(powerOffOperation)
+
+	ctx, cancel := context.WithTimeout(ctx, r.Timeouts.PowerOn)
+	defer cancel()
+
+	if err := powerOffVM(ctx, vm); err != nil {
+		return err
+	}
+
+	r.Recorder.Eventf(vg, corev1.EventTypeNormal, poweredOffReason, "Powered off replica %q", vm.Name())
+	return nil
+}
+
+// getOwnedReplicas returns the VMs in the group folder of vg by ownership.
+// Returns a NotFound error if the folder does not exist.
+func (r *VmGroupReconciler) getOwnedReplicas(ctx context.Context, parent string, vg *vmv1alpha1.VmGroup) (*ownedReplicas, error) {
+	vms, err := getReplicas(ctx, r.Finder, parent, getGroupName(vg.Namespace, vg.Name))
+	if err != nil {
+		return nil, err
+	}
+
+	return getOwnedReplicas(ctx, vms, string(vg.UID))
+}
+
+// paused returns true if changes to the replicas of vg are paused, either in
+// the spec or for all VmGroups
+func (r *VmGroupReconciler) paused(vg *vmv1alpha1.VmGroup) bool {
+	return r.Paused || vg.Spec.Paused
+}
+
+// refreshPausedStatus updates the status of a paused VmGroup without changing
+// its replicas
+func (r *VmGroupReconciler) refreshPausedStatus(ctx context.Context, pl *placement, vg *vmv1alpha1.VmGroup) (ctrl.Result, error) {
+	log := r.Log.WithValues("vmgroup", vg.Namespace+"/"+vg.Name)
+	desired := vg.Spec.Replicas
+
+	msg := "VmGroup paused, not changing replicas"
+	if r.Paused {
+		msg = "all VmGroups paused, not changing replicas"
+	}
+	log.Info(msg)
+
+	var nfe *find.NotFoundError
+
+	or, err := r.getOwnedReplicas(ctx, pl.folder, vg)
+	if err != nil {
+		if !errors.As(err, &nfe) {
+			msg := "could not get replicas for VmGroup from vCenter"
+			log.Error(err, msg)
+
+			vg.Status = createStatus(vg, vmv1alpha1.PendingStatusPhase, msg, err, nil, desired)
+			return ctrl.Result{RequeueAfter: defaultRequeue}, updateStatus(r.Client, vg)
+		}
+		or = &ownedReplicas{}
+	}
+	current := int32(len(or.owned))
+
+	ready := r.recordReplicas(ctx, pl, vg)
+
+	status := createStatus(vg, vmv1alpha1.PausedStatusPhase, msg, nil, &current, desired)
+	status.CloneMode = vg.Status.CloneMode
+	status.TemplateVersion = vg.Status.TemplateVersion
+	status.IgnoredVMs = vmNames(or.ignored())
+	status.ReadyReplicas = ready
+	vg.Status = status
+
+	// status is refreshed with the next resync
+	return ctrl.Result{}, updateStatus(r.Client, vg)
+}
+
+// recordReplicas updates the replica metrics of the VmGroup and returns the
+// number of ready replicas. Errors are only logged since metrics must not fail
+// the reconcile, the last observed number of ready replicas is returned then.
+func (r *VmGroupReconciler) recordReplicas(ctx context.Context, pl *placement, vg *vmv1alpha1.VmGroup) int32 {
+	or, err := r.getOwnedReplicas(ctx, pl.folder, vg)
+	if err != nil {
+		r.Log.Error(err, "could not get replicas for metrics", "vmgroup", vg.Namespace+"/"+vg.Name)
+		return vg.Status.ReadyReplicas
+	}
+	vms := or.owned
+
+	ready, err := countReady(ctx, vms)
+	if err != nil {
+		r.Log.Error(err, "could not get ready replicas for metrics", "vmgroup", vg.Namespace+"/"+vg.Name)
+		return vg.Status.ReadyReplicas
+	}
+
+	setReplicaMetrics(vg.Namespace, vg.Name, vg.Spec.Replicas, int32(len(vms)), ready)
+	return ready
+}
+
+// syncAntiAffinity keeps the DRS anti-affinity rules of the VmGroup in sync
+// with its replicas, one rule per cluster. Rules are removed if anti-affinity is
+// disabled in the spec.
+func (r *VmGroupReconciler) syncAntiAffinity(ctx context.Context, pl *placement, vg *vmv1alpha1.VmGroup) error {
+	groupName := getGroupName(vg.Namespace, vg.Name)
+	ruleName := getAntiAffinityRuleName(groupName)
+
+	var policy vmv1alpha1.AntiAffinityPolicy
+	if vg.Spec.Placement != nil {
+		policy = vg.Spec.Placement.AntiAffinity
+	}
+
+	if policy == "" {
+		return removeAntiAffinityRules(ctx, pl, ruleName)
+	}
+
+	// replicas changed during this reconcile, get the current list
+	or, err := r.getOwnedReplicas(ctx, pl.folder, vg)
+	if err != nil {
+		return errors.Wrap(err, "could not get replicas for anti-affinity rule")
+	}
+
+	zr, err := getZoneReplicas(ctx, pl.zones, or.owned)
+	if err != nil {
+		return errors.Wrap(err, "could not get zones for anti-affinity rule")
+	}
+
+	// zones might share a cluster
+	clusters := make(map[types.ManagedObjectReference]*object.ClusterComputeResource)
+	members := make(map[types.ManagedObjectReference][]*object.VirtualMachine)
+	for _, z := range pl.zones {
+		ref := z.cluster.Reference()
+		clusters[ref] = z.cluster
+		members[ref] = append(members[ref], zr.replicas[z]...)
+	}
+
+	mandatory := policy == vmv1alpha1.RequiredAntiAffinity
+	for ref, cluster := range clusters {
+		if err := ensureAntiAffinityRule(ctx, cluster, ruleName, mandatory, members[ref]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeAntiAffinityRules removes the DRS rule name from the clusters of all
+// zones of pl, including clusters only known from the zone resource pool
+func removeAntiAffinityRules(ctx context.Context, pl *placement, name string) error {
+	for _, z := range pl.zones {
+		cluster, err := zoneCluster(ctx, z)
+		if err != nil {
+			return err
+		}
+		if cluster == nil {
+			// no cluster, no DRS rules
+			continue
+		}
+		if err = removeAntiAffinityRule(ctx, cluster, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncTags attaches the owner tags and spec.tags to the group folder and all
+// replicas of the VmGroup and detaches tags removed from spec.tags
+func (r *VmGroupReconciler) syncTags(ctx context.Context, pl *placement, vg *vmv1alpha1.VmGroup) error {
+	group, err := getVMGroup(ctx, r.Finder, pl.folder, getGroupName(vg.Namespace, vg.Name))
+	if err != nil {
+		return err
+	}
+
+	or, err := r.getOwnedReplicas(ctx, pl.folder, vg)
+	if err != nil {
+		return errors.Wrap(err, "could not get replicas for tags")
+	}
+
+	objects := []mo.Reference{group}
+	for _, vm := range or.owned {
+		objects = append(objects, vm)
+	}
+
+	return r.Tagger.sync(ctx, vg, objects)
 }
 
 func (r *VmGroupReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	services, endpoints, err := serviceInformers(mgr)
+	if err != nil {
+		return err
+	}
+
+	owner := &handler.EnqueueRequestForOwner{OwnerType: &vmv1alpha1.VmGroup{}, IsController: true}
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&vmv1alpha1.VmGroup{}).
+		Watches(&source.Informer{Informer: services}, owner).
+		Watches(&source.Informer{Informer: endpoints}, owner).
+		Watches(&source.Kind{Type: &vmv1alpha1.VmTemplate{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.templateToGroups),
+		}).
+		Watches(&source.Kind{Type: &vmv1alpha1.VmNamespaceConfig{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.namespaceConfigToGroups),
+		}).
+		Watches(&source.Kind{Type: &vmv1alpha1.VmQuota{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.quotaToGroups),
+		}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		Complete(r)
 }
 
-func createStatus(phase vmv1alpha1.StatusPhase, msg string, err error, current *int32, desired int32) vmv1alpha1.VmGroupStatus {
+// templateToGroups returns a request for each VmGroup referencing the VmTemplate
+// so promotions are rolled out
+func (r *VmGroupReconciler) templateToGroups(o handler.MapObject) []reconcile.Request {
+	var list vmv1alpha1.VmGroupList
+	if err := r.List(context.Background(), &list, client.InNamespace(o.Meta.GetNamespace())); err != nil {
+		r.Log.Error(err, "could not list VmGroups for VmTemplate", "vmtemplate", o.Meta.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, vg := range list.Items {
+		if vg.Spec.TemplateRef != nil && vg.Spec.TemplateRef.Name == o.Meta.GetName() {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: k8stypes.NamespacedName{Namespace: vg.Namespace, Name: vg.Name},
+			})
+		}
+	}
+	return requests
+}
+
+// namespaceConfigToGroups returns a request for each VmGroup in the namespace
+// of the VmNamespaceConfig so changed restrictions are enforced
+func (r *VmGroupReconciler) namespaceConfigToGroups(o handler.MapObject) []reconcile.Request {
+	var list vmv1alpha1.VmGroupList
+	if err := r.List(context.Background(), &list, client.InNamespace(o.Meta.GetName())); err != nil {
+		r.Log.Error(err, "could not list VmGroups for VmNamespaceConfig", "vmnamespaceconfig", o.Meta.GetName())
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(list.Items))
+	for _, vg := range list.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: k8stypes.NamespacedName{Namespace: vg.Namespace, Name: vg.Name},
+		})
+	}
+	return requests
+}
+
+// quotaToGroups returns a request for each VmGroup capped by a VmQuota in the
+// namespace of the VmQuota so raised quotas are applied
+func (r *VmGroupReconciler) quotaToGroups(o handler.MapObject) []reconcile.Request {
+	var list vmv1alpha1.VmGroupList
+	if err := r.List(context.Background(), &list, client.InNamespace(o.Meta.GetNamespace())); err != nil {
+		r.Log.Error(err, "could not list VmGroups for VmQuota", "vmquota", o.Meta.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, vg := range list.Items {
+		if c := getCondition(vg.Status.Conditions, vmv1alpha1.QuotaExceededCondition); c != nil && c.Status == corev1.ConditionTrue {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: k8stypes.NamespacedName{Namespace: vg.Namespace, Name: vg.Name},
+			})
+		}
+	}
+	return requests
+}
+
+// runningPhase returns the phase of a reconciled VmGroup
+func runningPhase(spec vmv1alpha1.VmGroupSpec) vmv1alpha1.StatusPhase {
+	if spec.Replicas == 0 {
+		return vmv1alpha1.HibernatedStatusPhase
+	}
+	return vmv1alpha1.RunningStatusPhase
+}
+
+// readinessResult requeues until all powered on replicas are ready, e.g.
+// booted after a clone, so the scale subresource reflects the actual state.
+// VmGroups with a Service are resynced periodically to follow guest IP changes.
+func readinessResult(result ctrl.Result, ready int32, spec vmv1alpha1.VmGroupSpec) ctrl.Result {
+	var requeue time.Duration
+	switch {
+	case getPowerState(spec) == vmv1alpha1.PoweredOnPowerState && ready < spec.Replicas:
+		requeue = defaultRequeue
+	case spec.Service != nil:
+		requeue = serviceResync
+	}
+
+	if requeue > 0 && result.RequeueAfter == 0 {
+		result.RequeueAfter = requeue
+	}
+	return result
+}
+
+// createStatus returns a new status of vg. The number of ready replicas is
+// kept from the current status until it is observed again.
+func createStatus(vg *vmv1alpha1.VmGroup, phase vmv1alpha1.StatusPhase, msg string, err error, current *int32, desired int32) vmv1alpha1.VmGroupStatus {
 	if err != nil {
 		msg = msg + ": " + err.Error()
 	}
 
+	// timeouts are reported distinctly from other errors
+	if isTimeout(err) {
+		phase = vmv1alpha1.TimeoutStatusPhase
+	}
+
 	status := vmv1alpha1.VmGroupStatus{
 		Phase:           phase,
 		CurrentReplicas: current,
 		DesiredReplicas: desired,
+		ReadyReplicas:   vg.Status.ReadyReplicas,
+		Selector:        getSelector(vg),
 		LastMessage:     msg,
+		Folder:          vg.Status.Folder,
+		Service:         vg.Status.Service,
+		Tags:            vg.Status.Tags,
+		ReplicaDisk:     vg.Status.ReplicaDisk,
+		Conditions:      vg.Status.Conditions,
 	}
 	return status
 }
 
+// replicaIndex returns the index of vm in vms, 0 if not found
+func replicaIndex(vms []*object.VirtualMachine, vm *object.VirtualMachine) int {
+	for i := range vms {
+		if vms[i].Reference() == vm.Reference() {
+			return i
+		}
+	}
+	return 0
+}
+
 // delete any external resources associated with the VmGroup
 // Ensure that delete implementation is idempotent and safe to invoke
 // multiple types for same object.
 func (r *VmGroupReconciler) deleteExternalResources(ctx context.Context, finder *find.Finder, vg *vmv1alpha1.VmGroup) error {
 	var nfe *find.NotFoundError
 
-	// try to find the group folder
+	nc, err := getNamespaceConfig(ctx, r.Client, vg.Namespace)
+	if err != nil {
+		return err
+	}
+
 	groupName := getGroupName(vg.Namespace, vg.Name)
-	group, err := getVMGroup(ctx, finder, groupName)
+
+	// remove DRS rule before the replicas are gone, retained or orphaned
+	if vg.Spec.Placement != nil && vg.Spec.Placement.AntiAffinity != "" {
+		pl, err := resolvePlacement(ctx, finder, r.ResourcePool, vg, nc)
+		if err != nil && !errors.As(err, &nfe) {
+			return errors.Wrap(err, "could not resolve placement")
+		}
+
+		// cluster might be gone already
+		if err == nil {
+			if err := removeAntiAffinityRules(ctx, pl, getAntiAffinityRuleName(groupName)); err != nil {
+				return errors.Wrap(err, "could not delete anti-affinity rule")
+			}
+		}
+	}
+
+	if getDeletionPolicy(vg.Spec) == vmv1alpha1.OrphanDeletionPolicy {
+		r.Log.Info("orphaning VmGroup resources in vCenter", "vmgroup", vg.Namespace+"/"+vg.Name)
+		return nil
+	}
+
+	// try to find the group folder
+	parent := vmFolder(vg, nc)
+	group, err := getVMGroup(ctx, finder, parent, groupName)
 	if err != nil {
 		if errors.As(err, &nfe) {
 			// group already deleted, nothing to do
@@ -378,8 +1195,12 @@ func (r *VmGroupReconciler) deleteExternalResources(ctx context.Context, finder
 		return errors.Wrap(err, "could not get VmGroup")
 	}
 
+	if getDeletionPolicy(vg.Spec) == vmv1alpha1.RetainDeletionPolicy {
+		return r.retainExternalResources(ctx, vg, parent, group)
+	}
+
 	// get replicas (VMs) for VmGroup
-	vms, err := getReplicas(ctx, r.Finder, groupName)
+	or, err := r.getOwnedReplicas(ctx, parent, vg)
 	if err != nil {
 		if errors.As(err, &nfe) {
 			// all VMs already deleted, delete group folder
@@ -388,24 +1209,25 @@ func (r *VmGroupReconciler) deleteExternalResources(ctx context.Context, finder
 			if err := deleteFolder(ctx, group); err != nil {
 				return errors.Wrap(err, "could not delete VmGroup")
 			}
-			return nil
+			return r.Tagger.deleteOwnerTag(ctx, vg)
 		}
 		return errors.Wrap(err, "could not delete VmGroup")
 	}
 
-	lim := newLimiter(defaultConcurrency)
 	eg, egCtx := errgroup.WithContext(ctx) // used for concurrent operations against vCenter
 
-	for i := 0; i < len(vms); i++ {
-		lim.acquire()
+	// VMs the adoption policy adopts are deleted, too
+	adopt, unowned := or.adoptable(vg)
+	or.unowned = unowned
 
+	vms := append(or.owned, adopt...)
+	for i := 0; i < len(vms); i++ {
 		vm := vms[i]
 		msg := fmt.Sprintf("deleting virtual machine %q", vm.Name())
 		r.Log.Info(msg)
 
 		eg.Go(func() error {
-			defer lim.release()
-			return deleteVM(egCtx, vm)
+			return r.deleteReplica(egCtx, vg, vm)
 		})
 	}
 
@@ -414,12 +1236,101 @@ func (r *VmGroupReconciler) deleteExternalResources(ctx context.Context, finder
 		return errors.Wrap(err, "could not delete VmGroup")
 	}
 
+	// VMs not owned by this VmGroup are never deleted
+	if ignored := or.ignored(); len(ignored) > 0 {
+		r.Log.Info("not deleting group folder, it contains VMs not owned by VmGroup", "folder", group.InventoryPath, "vms", vmNames(ignored))
+		return nil
+	}
+
 	// all VMs deleted, finally delete group folder
 	msg := fmt.Sprintf("deleting group folder %q (path: %q)", groupName, group.InventoryPath)
 	r.Log.Info(msg)
+	if err = deleteFolder(ctx, group); err != nil {
+		return errors.Wrap(err, "could not delete VmGroup")
+	}
+
+	return r.Tagger.deleteOwnerTag(ctx, vg)
+}
+
+// retainExternalResources removes the ownership of all replicas of the VmGroup
+// and moves them to the retain folder if set
+func (r *VmGroupReconciler) retainExternalResources(ctx context.Context, vg *vmv1alpha1.VmGroup, parent string, group *object.Folder) error {
+	var nfe *find.NotFoundError
+
+	or, err := r.getOwnedReplicas(ctx, parent, vg)
+	if err != nil {
+		if !errors.As(err, &nfe) {
+			return errors.Wrap(err, "could not get replicas for VmGroup")
+		}
+		or = &ownedReplicas{}
+	}
+
+	adopt, _ := or.adoptable(vg)
+	vms := append(or.owned, adopt...)
+
+	objects := []mo.Reference{group}
+	refs := make([]types.ManagedObjectReference, 0, len(vms))
+	for _, vm := range vms {
+		msg := fmt.Sprintf("retaining virtual machine %q", vm.Name())
+		r.Log.Info(msg)
+
+		if err = clearOwner(ctx, vm); err != nil {
+			return err
+		}
+		objects = append(objects, vm)
+		refs = append(refs, vm.Reference())
+	}
+
+	if err = r.Tagger.detachOwnerTags(ctx, vg, objects); err != nil {
+		return err
+	}
+
+	if err = r.Tagger.deleteOwnerTag(ctx, vg); err != nil {
+		return err
+	}
+
+	if vg.Spec.RetainFolder == "" {
+		return nil
+	}
+
+	folder, err := r.Finder.Folder(ctx, vg.Spec.RetainFolder)
+	if err != nil {
+		return errors.Wrapf(err, "could not find retain folder %q", vg.Spec.RetainFolder)
+	}
+
+	if len(refs) > 0 {
+		msg := fmt.Sprintf("moving %d retained replica(s) to folder %q", len(refs), folder.InventoryPath)
+		r.Log.Info(msg)
+
+		task, err := folder.MoveInto(ctx, refs)
+		if err != nil {
+			return errors.Wrap(err, "could not initiate move task")
+		}
+
+		if err = waitTask(ctx, task); err != nil {
+			return errors.Wrapf(err, "could not move replicas to folder %q", folder.InventoryPath)
+		}
+	}
+
+	// VMs not owned by this VmGroup are never moved
+	if len(or.ignored()) > 0 {
+		return nil
+	}
 	return errors.Wrap(deleteFolder(ctx, group), "could not delete VmGroup")
 }
 
+// countSet returns the number of true values, used to validate mutually
+// exclusive fields
+func countSet(values ...bool) int {
+	n := 0
+	for _, v := range values {
+		if v {
+			n++
+		}
+	}
+	return n
+}
+
 // Helper functions to check and remove string from a slice of strings.
 func containsString(slice []string, s string) bool {
 	for _, item := range slice {
@@ -451,3 +1362,8 @@ func generateName() string {
 func getGroupName(namespace, name string) string {
 	return fmt.Sprintf("%s-%s", namespace, name)
 }
+
+// getSelector returns the label selector of the replicas of vg
+func getSelector(vg *vmv1alpha1.VmGroup) string {
+	return labels.SelectorFromSet(labels.Set{VmGroupLabel: vg.Name}).String()
+}
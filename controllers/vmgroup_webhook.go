@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	vmv1alpha1 "codeconnect/operator/api/v1alpha1"
+)
+
+// VmGroupValidatorPath is the path the VmGroupValidator is served on
+const VmGroupValidatorPath = "/validate-vm-codeconnect-vmworld-com-v1alpha1-vmgroup"
+
+// +kubebuilder:webhook:path=/validate-vm-codeconnect-vmworld-com-v1alpha1-vmgroup,mutating=false,failurePolicy=fail,groups=vm.codeconnect.vmworld.com,resources=vmgroups,verbs=create;update,versions=v1alpha1,name=vvmgroup.codeconnect.vmworld.com
+
+// VmGroupValidator rejects VmGroups violating the VmNamespaceConfig or a
+// VmQuota of their namespace. The same checks are repeated in Reconcile, e.g.
+// for VmGroups created before the VmNamespaceConfig or scaled with the scale
+// subresource.
+type VmGroupValidator struct {
+	Client  client.Client
+	decoder *admission.Decoder
+}
+
+// Handle validates VmGroups on create and update
+func (v *VmGroupValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	vg := &vmv1alpha1.VmGroup{}
+	if err := v.decoder.Decode(req, vg); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	// deletion only removes the finalizer
+	if !vg.ObjectMeta.DeletionTimestamp.IsZero() {
+		return admission.Allowed("")
+	}
+
+	// allow metadata changes, e.g. finalizers, of VmGroups created before the
+	// VmNamespaceConfig restricting them
+	var old *vmv1alpha1.VmGroup
+	if req.Operation == admissionv1beta1.Update {
+		old = &vmv1alpha1.VmGroup{}
+		if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if equality.Semantic.DeepEqual(old.Spec, vg.Spec) {
+			return admission.Allowed("")
+		}
+
+		// replicas stay in the folder of the existing group folder
+		if old.Status.Folder != "" && placementFolder(old.Spec) != placementFolder(vg.Spec) {
+			return admission.Denied(fmt.Sprintf("placement folder cannot be changed, replicas are placed in folder %q", old.Status.Folder))
+		}
+	}
+
+	nc, err := getNamespaceConfig(ctx, v.Client, req.Namespace)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	if err = validateNamespaceSpec(nc, vg.Spec); err != nil {
+		return admission.Denied(err.Error())
+	}
+
+	// VmTemplates without a validated version are checked in Reconcile
+	if vg.Spec.TemplateRef != nil {
+		if src, err := getTemplateSource(ctx, v.Client, vg); err == nil {
+			if err = templateAllowed(nc, src); err != nil {
+				return admission.Denied(err.Error())
+			}
+		}
+	}
+
+	if err = v.checkQuotas(ctx, old, vg); err != nil {
+		return admission.Denied(err.Error())
+	}
+
+	return admission.Allowed("")
+}
+
+// checkQuotas returns an error if vg increases the resources of the namespace
+// beyond a VmQuota. The replica disk is only known for reconciled VmGroups,
+// new VmGroups are checked for disk in Reconcile.
+func (v *VmGroupValidator) checkQuotas(ctx context.Context, old, vg *vmv1alpha1.VmGroup) error {
+	quotas, groups, err := getQuotas(ctx, v.Client, vg.Namespace)
+	if err != nil {
+		return err
+	}
+
+	others := namespaceQuotaUsage(groups, vg.Name)
+	prev := others
+	if old != nil {
+		vg.Status.ReplicaDisk = old.Status.ReplicaDisk
+		prev = others.add(groupQuotaUsage(old, quotaReplicas(old)))
+	}
+	used := others.add(groupQuotaUsage(vg, vg.Spec.Replicas))
+
+	for _, q := range quotas {
+		if exceeded := quotaViolations(q.Spec.Hard, used, prev); len(exceeded) > 0 {
+			return errors.Errorf("exceeds VmQuota %q: %s", q.Name, strings.Join(exceeded, ", "))
+		}
+	}
+	return nil
+}
+
+// InjectDecoder implements admission.DecoderInjector
+func (v *VmGroupValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// placementFolder returns the placement folder of spec, empty if not set
+func placementFolder(spec vmv1alpha1.VmGroupSpec) string {
+	if spec.Placement == nil {
+		return ""
+	}
+	return spec.Placement.Folder
+}
@@ -0,0 +1,327 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/find"
+	corev1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	vmv1alpha1 "codeconnect/operator/api/v1alpha1"
+)
+
+const (
+	autoscaleInterval = time.Minute
+	// utilization ratio to the target within which the replicas are not changed
+	autoscaleTolerance = 0.1
+
+	defaultScaleDownStabilization = 300 // seconds
+)
+
+// event reasons recorded on VmGroupAutoscalers
+const (
+	scaledReason = "Scaled"
+)
+
+// VmGroupAutoscalerReconciler reconciles a VmGroupAutoscaler object
+type VmGroupAutoscalerReconciler struct {
+	client.Client
+	Finder   *find.Finder
+	Recorder record.EventRecorder
+	Timeouts Timeouts
+	Context  context.Context // cancelled on shutdown
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=vm.codeconnect.vmworld.com,resources=vmgroupautoscalers,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=vm.codeconnect.vmworld.com,resources=vmgroupautoscalers/status,verbs=get;update;patch
+
+// Reconcile computes the desired replicas of the referenced VmGroup from the
+// vSphere performance counters of its replicas and patches spec.replicas. The
+// VmGroupAutoscaler is requeued every autoscaleInterval, status updates do not
+// trigger a reconcile.
+func (r *VmGroupAutoscalerReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx, cancel := context.WithTimeout(r.Context, r.Timeouts.Reconcile)
+	defer cancel()
+
+	log := r.Log.WithValues("vmgroupautoscaler", req.NamespacedName)
+
+	va := &vmv1alpha1.VmGroupAutoscaler{}
+	if err := r.Client.Get(ctx, req.NamespacedName, va); err != nil {
+		if !k8serr.IsNotFound(err) {
+			log.Error(err, "unable to fetch VmGroupAutoscaler")
+		}
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	msg := fmt.Sprintf("received reconcile request for %q (namespace: %q)", va.GetName(), va.GetNamespace())
+	log.Info(msg)
+
+	if err := validateAutoscaler(va.Spec); err != nil {
+		msg := "invalid VmGroupAutoscaler spec"
+		log.Error(err, msg)
+
+		va.Status.Phase = vmv1alpha1.ErrorStatusPhase
+		va.Status.LastMessage = msg + ": " + err.Error()
+
+		// ignoring this VmGroupAutoscaler until the spec is fixed
+		return ctrl.Result{}, updateStatus(r.Client, va)
+	}
+
+	vg := &vmv1alpha1.VmGroup{}
+	key := client.ObjectKey{Namespace: va.Namespace, Name: va.Spec.ScaleTargetRef.Name}
+	if err := r.Client.Get(ctx, key, vg); err != nil {
+		msg := fmt.Sprintf("could not get VmGroup %q", key.Name)
+		log.Error(err, msg)
+
+		va.Status.Phase = vmv1alpha1.PendingStatusPhase
+		va.Status.LastMessage = msg + ": " + err.Error()
+		return ctrl.Result{RequeueAfter: autoscaleInterval}, updateStatus(r.Client, va)
+	}
+
+	current := vg.Spec.Replicas
+	va.Status.CurrentReplicas = current
+
+	// no replicas, no metrics
+	if current == 0 {
+		va.Status.Phase = vmv1alpha1.PendingStatusPhase
+		va.Status.LastMessage = "VmGroup scaled to zero, not autoscaling"
+		return ctrl.Result{RequeueAfter: autoscaleInterval}, updateStatus(r.Client, va)
+	}
+
+	// at most one recommendation per interval, e.g. on spec changes
+	now := time.Now()
+	if n := len(va.Status.Recommendations); n > 0 {
+		if wait := autoscaleInterval - now.Sub(va.Status.Recommendations[n-1].Time.Time); wait > 0 {
+			return ctrl.Result{RequeueAfter: wait}, nil
+		}
+	}
+
+	usage, err := r.getUsage(ctx, vg)
+	if err != nil {
+		msg := "could not get utilization of replicas"
+		log.Error(err, msg)
+
+		va.Status.Phase = vmv1alpha1.PendingStatusPhase
+		va.Status.LastMessage = msg + ": " + err.Error()
+		return ctrl.Result{RequeueAfter: autoscaleInterval}, updateStatus(r.Client, va)
+	}
+
+	if usage.vms == 0 {
+		va.Status.Phase = vmv1alpha1.PendingStatusPhase
+		va.Status.LastMessage = "no performance counters available for replicas, e.g. powered off"
+		return ctrl.Result{RequeueAfter: autoscaleInterval}, updateStatus(r.Client, va)
+	}
+
+	cpu, mem := int32(math.Round(usage.cpu)), int32(math.Round(usage.memory))
+	va.Status.CurrentCPUUtilization = &cpu
+	va.Status.CurrentMemoryUtilization = &mem
+
+	recommended := recommendReplicas(va.Spec, current, usage)
+	va.Status.Recommendations = append(va.Status.Recommendations, vmv1alpha1.Recommendation{
+		Replicas: recommended,
+		Time:     metav1.Time{Time: now},
+	})
+
+	desired := stabilize(va.Spec, &va.Status, current, now)
+	va.Status.DesiredReplicas = desired
+
+	va.Status.Phase = vmv1alpha1.RunningStatusPhase
+	va.Status.LastMessage = fmt.Sprintf("%d replica(s) at %d%% cpu and %d%% memory utilization", current, cpu, mem)
+
+	if desired != current {
+		msg := fmt.Sprintf("scaling VmGroup %q from %d to %d replica(s) at %d%% cpu and %d%% memory utilization", vg.Name, current, desired, cpu, mem)
+		log.Info(msg)
+
+		patch := client.MergeFrom(vg.DeepCopy())
+		vg.Spec.Replicas = desired
+		if err = r.Client.Patch(ctx, vg, patch); err != nil {
+			msg := fmt.Sprintf("could not scale VmGroup %q", vg.Name)
+			log.Error(err, msg)
+
+			va.Status.Phase = vmv1alpha1.PendingStatusPhase
+			va.Status.LastMessage = msg + ": " + err.Error()
+			return ctrl.Result{RequeueAfter: autoscaleInterval}, updateStatus(r.Client, va)
+		}
+
+		r.Recorder.Eventf(va, corev1.EventTypeNormal, scaledReason, "Scaled VmGroup %q from %d to %d replica(s)", vg.Name, current, desired)
+		va.Status.LastScaleTime = &metav1.Time{Time: now}
+		va.Status.LastMessage = msg
+	}
+
+	return ctrl.Result{RequeueAfter: autoscaleInterval}, updateStatus(r.Client, va)
+}
+
+// getUsage returns the utilization of the replicas of vg
+func (r *VmGroupAutoscalerReconciler) getUsage(ctx context.Context, vg *vmv1alpha1.VmGroup) (*groupUsage, error) {
+	vms, err := getVmGroupReplicas(ctx, r.Client, r.Finder, vg)
+	if err != nil {
+		return nil, err
+	}
+	return getGroupUsage(ctx, vms)
+}
+
+func validateAutoscaler(spec vmv1alpha1.VmGroupAutoscalerSpec) error {
+	if spec.TargetCPUUtilization == nil && spec.TargetMemoryUtilization == nil {
+		return errors.New("at least one of targetCPUUtilization or targetMemoryUtilization must be set")
+	}
+
+	if min := getMinReplicas(spec); min > spec.MaxReplicas {
+		return errors.Errorf("minReplicas %d must not be greater than maxReplicas %d", min, spec.MaxReplicas)
+	}
+	return nil
+}
+
+// recommendReplicas returns the replicas needed to meet the utilization targets
+// like the Kubernetes HPA, i.e. ceil(current * utilization / target). Replicas
+// without samples, e.g. still booting, count as 0% utilization when scaling up
+// and as the target when scaling down, and the replicas are not changed if this
+// reverses the scale. The highest recommendation of all targets is returned.
+func recommendReplicas(spec vmv1alpha1.VmGroupAutoscalerSpec, current int32, usage *groupUsage) int32 {
+	sampled := float64(usage.vms)
+	missing := float64(current) - sampled
+	if missing < 0 {
+		missing = 0
+	}
+
+	recommend := func(utilization float64, target int32) int32 {
+		ratio := utilization / float64(target)
+		if math.Abs(ratio-1) <= autoscaleTolerance {
+			return current
+		}
+
+		if missing > 0 {
+			var fill float64 // scale up
+			if ratio < 1 {
+				fill = float64(target)
+			}
+			adjusted := (utilization*sampled + fill*missing) / (float64(target) * (sampled + missing))
+			if math.Abs(adjusted-1) <= autoscaleTolerance || (ratio > 1) != (adjusted > 1) {
+				return current
+			}
+			ratio = adjusted
+		}
+		return int32(math.Ceil(float64(current) * ratio))
+	}
+
+	var recommended int32
+	if spec.TargetCPUUtilization != nil {
+		recommended = recommend(usage.cpu, *spec.TargetCPUUtilization)
+	}
+	if spec.TargetMemoryUtilization != nil {
+		if m := recommend(usage.memory, *spec.TargetMemoryUtilization); m > recommended {
+			recommended = m
+		}
+	}
+	return clampReplicas(spec, recommended)
+}
+
+// stabilize returns the desired replicas from the recommendations in the
+// stabilization windows: the lowest recommendation of the scale up window and
+// the highest recommendation of the scale down window bound the change from
+// current. Recommendations outside both windows are removed from status.
+func stabilize(spec vmv1alpha1.VmGroupAutoscalerSpec, status *vmv1alpha1.VmGroupAutoscalerStatus, current int32, now time.Time) int32 {
+	up := time.Duration(getScaleUpStabilization(spec)) * time.Second
+	down := time.Duration(getScaleDownStabilization(spec)) * time.Second
+
+	keep := up
+	if down > keep {
+		keep = down
+	}
+
+	var (
+		recommendations []vmv1alpha1.Recommendation
+		upRecommended   int32 = math.MaxInt32
+		downRecommended int32
+	)
+	for _, rec := range status.Recommendations {
+		age := now.Sub(rec.Time.Time)
+		if age > keep {
+			continue
+		}
+		recommendations = append(recommendations, rec)
+
+		if age <= up && rec.Replicas < upRecommended {
+			upRecommended = rec.Replicas
+		}
+		if age <= down && rec.Replicas > downRecommended {
+			downRecommended = rec.Replicas
+		}
+	}
+	status.Recommendations = recommendations
+
+	desired := current
+	if desired < upRecommended {
+		desired = upRecommended
+	}
+	if desired > downRecommended {
+		desired = downRecommended
+	}
+	return clampReplicas(spec, desired)
+}
+
+func clampReplicas(spec vmv1alpha1.VmGroupAutoscalerSpec, replicas int32) int32 {
+	if min := getMinReplicas(spec); replicas < min {
+		return min
+	}
+	if replicas > spec.MaxReplicas {
+		return spec.MaxReplicas
+	}
+	return replicas
+}
+
+func getMinReplicas(spec vmv1alpha1.VmGroupAutoscalerSpec) int32 {
+	if spec.MinReplicas == nil {
+		return 1
+	}
+	return *spec.MinReplicas
+}
+
+func getScaleUpStabilization(spec vmv1alpha1.VmGroupAutoscalerSpec) int32 {
+	if spec.ScaleUpStabilizationSeconds == nil {
+		return 0
+	}
+	return *spec.ScaleUpStabilizationSeconds
+}
+
+func getScaleDownStabilization(spec vmv1alpha1.VmGroupAutoscalerSpec) int32 {
+	if spec.ScaleDownStabilizationSeconds == nil {
+		return defaultScaleDownStabilization
+	}
+	return *spec.ScaleDownStabilizationSeconds
+}
+
+func (r *VmGroupAutoscalerReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&vmv1alpha1.VmGroupAutoscaler{}).
+		WithEventFilter(predicate.GenerationChangedPredicate{}).
+		Complete(r)
+}
@@ -0,0 +1,195 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	vmv1alpha1 "codeconnect/operator/api/v1alpha1"
+)
+
+func TestRecommendReplicas(t *testing.T) {
+	cpu := func(target int32) vmv1alpha1.VmGroupAutoscalerSpec {
+		return vmv1alpha1.VmGroupAutoscalerSpec{MaxReplicas: 10, TargetCPUUtilization: int32Ptr(target)}
+	}
+
+	tests := []struct {
+		name    string
+		spec    vmv1alpha1.VmGroupAutoscalerSpec
+		current int32
+		usage   groupUsage
+		want    int32
+	}{
+		{
+			name:    "within tolerance",
+			spec:    cpu(50),
+			current: 3,
+			usage:   groupUsage{cpu: 52, vms: 3},
+			want:    3,
+		},
+		{
+			name:    "scale up",
+			spec:    cpu(50),
+			current: 2,
+			usage:   groupUsage{cpu: 100, vms: 2},
+			want:    4,
+		},
+		{
+			name:    "scale down",
+			spec:    cpu(50),
+			current: 4,
+			usage:   groupUsage{cpu: 25, vms: 4},
+			want:    2,
+		},
+		{
+			name:    "rounds up",
+			spec:    cpu(50),
+			current: 3,
+			usage:   groupUsage{cpu: 70, vms: 3},
+			want:    5,
+		},
+		{
+			name:    "capped at max replicas",
+			spec:    cpu(50),
+			current: 8,
+			usage:   groupUsage{cpu: 100, vms: 8},
+			want:    10,
+		},
+		{
+			name:    "min replicas defaults to 1",
+			spec:    cpu(50),
+			current: 2,
+			usage:   groupUsage{cpu: 5, vms: 2},
+			want:    1,
+		},
+		{
+			name:    "min replicas",
+			spec:    vmv1alpha1.VmGroupAutoscalerSpec{MinReplicas: int32Ptr(2), MaxReplicas: 10, TargetCPUUtilization: int32Ptr(50)},
+			current: 4,
+			usage:   groupUsage{cpu: 5, vms: 4},
+			want:    2,
+		},
+		{
+			name:    "missing samples count as 0% when scaling up",
+			spec:    cpu(50),
+			current: 4,
+			usage:   groupUsage{cpu: 200, vms: 2},
+			want:    8,
+		},
+		{
+			name:    "missing samples cancel scale up",
+			spec:    cpu(50),
+			current: 4,
+			usage:   groupUsage{cpu: 100, vms: 2},
+			want:    4,
+		},
+		{
+			name:    "missing samples count as target when scaling down",
+			spec:    cpu(50),
+			current: 4,
+			usage:   groupUsage{cpu: 10, vms: 2},
+			want:    3,
+		},
+		{
+			name:    "no samples",
+			spec:    cpu(50),
+			current: 3,
+			usage:   groupUsage{},
+			want:    3,
+		},
+		{
+			name: "highest of cpu and memory",
+			spec: vmv1alpha1.VmGroupAutoscalerSpec{
+				MaxReplicas:             10,
+				TargetCPUUtilization:    int32Ptr(50),
+				TargetMemoryUtilization: int32Ptr(50),
+			},
+			current: 2,
+			usage:   groupUsage{cpu: 25, memory: 100, vms: 2},
+			want:    4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usage := tt.usage
+			if got := recommendReplicas(tt.spec, tt.current, &usage); got != tt.want {
+				t.Errorf("recommendReplicas() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStabilize(t *testing.T) {
+	now := time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC)
+	rec := func(age time.Duration, replicas int32) vmv1alpha1.Recommendation {
+		return vmv1alpha1.Recommendation{Replicas: replicas, Time: metav1.NewTime(now.Add(-age))}
+	}
+
+	tests := []struct {
+		name            string
+		spec            vmv1alpha1.VmGroupAutoscalerSpec
+		current         int32
+		recommendations []vmv1alpha1.Recommendation
+		want            int32
+		wantKept        int
+	}{
+		{
+			name:            "scale up immediately",
+			spec:            vmv1alpha1.VmGroupAutoscalerSpec{MaxReplicas: 10},
+			current:         2,
+			recommendations: []vmv1alpha1.Recommendation{rec(time.Minute, 2), rec(0, 5)},
+			want:            5,
+			wantKept:        2,
+		},
+		{
+			name:            "scale down held by the scale down window",
+			spec:            vmv1alpha1.VmGroupAutoscalerSpec{MaxReplicas: 10},
+			current:         5,
+			recommendations: []vmv1alpha1.Recommendation{rec(time.Minute, 5), rec(0, 2)},
+			want:            5,
+			wantKept:        2,
+		},
+		{
+			name:            "scale down to the highest recommendation in the window",
+			spec:            vmv1alpha1.VmGroupAutoscalerSpec{MaxReplicas: 10},
+			current:         5,
+			recommendations: []vmv1alpha1.Recommendation{rec(6*time.Minute, 5), rec(time.Minute, 3), rec(0, 2)},
+			want:            3,
+			wantKept:        2,
+		},
+		{
+			name: "scale up to the lowest recommendation in the window",
+			spec: vmv1alpha1.VmGroupAutoscalerSpec{
+				MaxReplicas:                   10,
+				ScaleUpStabilizationSeconds:   int32Ptr(120),
+				ScaleDownStabilizationSeconds: int32Ptr(0),
+			},
+			current:         2,
+			recommendations: []vmv1alpha1.Recommendation{rec(3*time.Minute, 2), rec(time.Minute, 3), rec(0, 6)},
+			want:            3,
+			wantKept:        2,
+		},
+		{
+			name:            "clamped to max replicas",
+			spec:            vmv1alpha1.VmGroupAutoscalerSpec{MaxReplicas: 4},
+			current:         6,
+			recommendations: []vmv1alpha1.Recommendation{rec(0, 6)},
+			want:            4,
+			wantKept:        1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := &vmv1alpha1.VmGroupAutoscalerStatus{Recommendations: tt.recommendations}
+			if got := stabilize(tt.spec, status, tt.current, now); got != tt.want {
+				t.Errorf("stabilize() = %d, want %d", got, tt.want)
+			}
+			if got := len(status.Recommendations); got != tt.wantKept {
+				t.Errorf("stabilize() kept %d recommendations, want %d", got, tt.wantKept)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	vmv1alpha1 "codeconnect/operator/api/v1alpha1"
+)
+
+// event reasons recorded on VmGroupSchedules
+const (
+	actionAppliedReason = "ActionApplied"
+)
+
+// VmGroupScheduleReconciler reconciles a VmGroupSchedule object
+type VmGroupScheduleReconciler struct {
+	client.Client
+	Recorder record.EventRecorder
+	Timeouts Timeouts
+	Context  context.Context // cancelled on shutdown
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=vm.codeconnect.vmworld.com,resources=vmgroupschedules,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=vm.codeconnect.vmworld.com,resources=vmgroupschedules/status,verbs=get;update;patch
+
+// Reconcile applies the latest due action of a VmGroupSchedule to the
+// referenced VmGroup and requeues until the next action is due
+func (r *VmGroupScheduleReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx, cancel := context.WithTimeout(r.Context, r.Timeouts.Reconcile)
+	defer cancel()
+
+	log := r.Log.WithValues("vmgroupschedule", req.NamespacedName)
+
+	vs := &vmv1alpha1.VmGroupSchedule{}
+	if err := r.Client.Get(ctx, req.NamespacedName, vs); err != nil {
+		if !k8serr.IsNotFound(err) {
+			log.Error(err, "unable to fetch VmGroupSchedule")
+		}
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	msg := fmt.Sprintf("received reconcile request for %q (namespace: %q)", vs.GetName(), vs.GetNamespace())
+	log.Info(msg)
+
+	loc, schedules, err := parseSchedules(vs.Spec)
+	if err != nil {
+		msg := "invalid VmGroupSchedule spec"
+		log.Error(err, msg)
+
+		vs.Status.Phase = vmv1alpha1.ErrorStatusPhase
+		vs.Status.LastMessage = msg + ": " + err.Error()
+
+		// ignoring this VmGroupSchedule until the spec is fixed
+		return ctrl.Result{}, updateStatus(r.Client, vs)
+	}
+
+	now := time.Now().In(loc)
+	last := vs.CreationTimestamp.Time
+	if vs.Status.LastAction != nil {
+		last = vs.Status.LastAction.Time.Time
+	}
+
+	due, dueTime := dueAction(vs.Spec.Actions, schedules, last.In(loc), now)
+
+	vs.Status.Phase = vmv1alpha1.RunningStatusPhase
+	vs.Status.LastMessage = "successfully reconciled VmGroupSchedule"
+
+	if due != nil {
+		msg := fmt.Sprintf("applying action %q to VmGroup %q", due.Name, vs.Spec.VmGroupRef.Name)
+		log.Info(msg)
+
+		if err = r.applyAction(ctx, vs, due); err != nil {
+			msg := fmt.Sprintf("could not apply action %q", due.Name)
+			log.Error(err, msg)
+
+			vs.Status.Phase = vmv1alpha1.PendingStatusPhase
+			vs.Status.LastMessage = msg + ": " + err.Error()
+			return ctrl.Result{RequeueAfter: defaultRequeue}, updateStatus(r.Client, vs)
+		}
+
+		r.Recorder.Eventf(vs, corev1.EventTypeNormal, actionAppliedReason, "Applied action %q to VmGroup %q", due.Name, vs.Spec.VmGroupRef.Name)
+		vs.Status.LastAction = &vmv1alpha1.ScheduledActionStatus{
+			Name: due.Name,
+			Time: metav1.Time{Time: dueTime},
+		}
+		vs.Status.LastMessage = msg
+	}
+
+	result := ctrl.Result{}
+	vs.Status.NextAction = nil
+	for i, s := range schedules {
+		t := s.Next(now)
+		if t.IsZero() {
+			continue
+		}
+
+		if vs.Status.NextAction == nil || t.Before(vs.Status.NextAction.Time.Time) {
+			vs.Status.NextAction = &vmv1alpha1.ScheduledActionStatus{
+				Name: vs.Spec.Actions[i].Name,
+				Time: metav1.Time{Time: t},
+			}
+			result.RequeueAfter = t.Sub(now)
+		}
+	}
+
+	return result, updateStatus(r.Client, vs)
+}
+
+// applyAction patches the replicas and power state of the referenced VmGroup
+func (r *VmGroupScheduleReconciler) applyAction(ctx context.Context, vs *vmv1alpha1.VmGroupSchedule, action *vmv1alpha1.ScheduleAction) error {
+	vg := &vmv1alpha1.VmGroup{}
+	key := client.ObjectKey{Namespace: vs.Namespace, Name: vs.Spec.VmGroupRef.Name}
+	if err := r.Client.Get(ctx, key, vg); err != nil {
+		return errors.Wrapf(err, "could not get VmGroup %q", key.Name)
+	}
+
+	patch := client.MergeFrom(vg.DeepCopy())
+	if action.Replicas != nil {
+		vg.Spec.Replicas = *action.Replicas
+	}
+	if action.PowerState != "" {
+		vg.Spec.PowerState = action.PowerState
+	}
+
+	return errors.Wrapf(r.Client.Patch(ctx, vg, patch), "could not patch VmGroup %q", key.Name)
+}
+
+// parseSchedules returns the time zone and the parsed schedules of the actions
+// in spec
+func parseSchedules(spec vmv1alpha1.VmGroupScheduleSpec) (*time.Location, []cron.Schedule, error) {
+	// empty time zone is UTC
+	loc, err := time.LoadLocation(spec.TimeZone)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "invalid time zone %q", spec.TimeZone)
+	}
+
+	if len(spec.Actions) == 0 {
+		return nil, nil, errors.New("at least one action must be set")
+	}
+
+	schedules := make([]cron.Schedule, len(spec.Actions))
+	for i, a := range spec.Actions {
+		if a.Replicas == nil && a.PowerState == "" {
+			return nil, nil, errors.Errorf("action %q must set replicas or powerState", a.Name)
+		}
+
+		// schedules are evaluated in the location of the time passed to Next
+		schedules[i], err = cron.ParseStandard(a.Schedule)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "invalid schedule of action %q", a.Name)
+		}
+	}
+	return loc, schedules, nil
+}
+
+// dueAction returns the action with the latest activation after last and not
+// after now, nil if none is due. Actions missed while the operator was down
+// are not replayed, only the latest due action is applied.
+func dueAction(actions []vmv1alpha1.ScheduleAction, schedules []cron.Schedule, last, now time.Time) (*vmv1alpha1.ScheduleAction, time.Time) {
+	var (
+		due     *vmv1alpha1.ScheduleAction
+		dueTime time.Time
+	)
+	for i, s := range schedules {
+		t, ok := latestActivation(s, last, now)
+		if ok && t.After(dueTime) {
+			due = &actions[i]
+			dueTime = t
+		}
+	}
+	return due, dueTime
+}
+
+// latestActivation returns the latest activation of s after from and not after
+// to
+func latestActivation(s cron.Schedule, from, to time.Time) (time.Time, bool) {
+	t := s.Next(from)
+	if t.IsZero() || t.After(to) {
+		return time.Time{}, false
+	}
+
+	for {
+		next := s.Next(t)
+		if next.IsZero() || next.After(to) {
+			return t, true
+		}
+		t = next
+	}
+}
+
+func (r *VmGroupScheduleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&vmv1alpha1.VmGroupSchedule{}).
+		Complete(r)
+}
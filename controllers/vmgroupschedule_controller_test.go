@@ -0,0 +1,225 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	vmv1alpha1 "codeconnect/operator/api/v1alpha1"
+)
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
+func TestParseSchedules(t *testing.T) {
+	action := func(schedule string) vmv1alpha1.ScheduleAction {
+		return vmv1alpha1.ScheduleAction{Name: "a", Schedule: schedule, Replicas: int32Ptr(1)}
+	}
+
+	tests := []struct {
+		name    string
+		spec    vmv1alpha1.VmGroupScheduleSpec
+		wantLoc string
+		wantErr bool
+	}{
+		{
+			name:    "defaults to UTC",
+			spec:    vmv1alpha1.VmGroupScheduleSpec{Actions: []vmv1alpha1.ScheduleAction{action("0 8 * * 1-5")}},
+			wantLoc: "UTC",
+		},
+		{
+			name:    "time zone",
+			spec:    vmv1alpha1.VmGroupScheduleSpec{TimeZone: "Europe/Berlin", Actions: []vmv1alpha1.ScheduleAction{action("@daily")}},
+			wantLoc: "Europe/Berlin",
+		},
+		{
+			name: "power state only",
+			spec: vmv1alpha1.VmGroupScheduleSpec{Actions: []vmv1alpha1.ScheduleAction{
+				{Name: "off", Schedule: "0 20 * * *", PowerState: vmv1alpha1.PoweredOffPowerState},
+			}},
+			wantLoc: "UTC",
+		},
+		{
+			name:    "invalid time zone",
+			spec:    vmv1alpha1.VmGroupScheduleSpec{TimeZone: "Mars/Olympus", Actions: []vmv1alpha1.ScheduleAction{action("@daily")}},
+			wantErr: true,
+		},
+		{
+			name:    "no actions",
+			spec:    vmv1alpha1.VmGroupScheduleSpec{},
+			wantErr: true,
+		},
+		{
+			name:    "action without replicas and power state",
+			spec:    vmv1alpha1.VmGroupScheduleSpec{Actions: []vmv1alpha1.ScheduleAction{{Name: "noop", Schedule: "@daily"}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid schedule",
+			spec:    vmv1alpha1.VmGroupScheduleSpec{Actions: []vmv1alpha1.ScheduleAction{action("0 25 * * *")}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, schedules, err := parseSchedules(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSchedules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if loc.String() != tt.wantLoc {
+				t.Errorf("parseSchedules() location = %q, want %q", loc, tt.wantLoc)
+			}
+			if len(schedules) != len(tt.spec.Actions) {
+				t.Errorf("parseSchedules() returned %d schedules, want %d", len(schedules), len(tt.spec.Actions))
+			}
+		})
+	}
+}
+
+func TestLatestActivation(t *testing.T) {
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2020, 9, day, hour, min, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		schedule string
+		from, to time.Time
+		want     time.Time
+		wantOK   bool
+	}{
+		{
+			name:     "not due",
+			schedule: "0 8 * * *",
+			from:     at(1, 9, 0),
+			to:       at(1, 12, 0),
+		},
+		{
+			name:     "due",
+			schedule: "0 8 * * *",
+			from:     at(1, 7, 0),
+			to:       at(1, 12, 0),
+			want:     at(1, 8, 0),
+			wantOK:   true,
+		},
+		{
+			name:     "activation at to is due",
+			schedule: "0 8 * * *",
+			from:     at(1, 7, 0),
+			to:       at(1, 8, 0),
+			want:     at(1, 8, 0),
+			wantOK:   true,
+		},
+		{
+			name:     "activation at from is not due again",
+			schedule: "0 8 * * *",
+			from:     at(1, 8, 0),
+			to:       at(1, 12, 0),
+		},
+		{
+			name:     "missed activations are skipped",
+			schedule: "0 8 * * *",
+			from:     at(1, 7, 0),
+			to:       at(4, 12, 0),
+			want:     at(4, 8, 0),
+			wantOK:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := cron.ParseStandard(tt.schedule)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, ok := latestActivation(s, tt.from, tt.to)
+			if ok != tt.wantOK || !got.Equal(tt.want) {
+				t.Errorf("latestActivation() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestDueAction(t *testing.T) {
+	actions := []vmv1alpha1.ScheduleAction{
+		{Name: "start", Schedule: "0 8 * * 1-5", PowerState: vmv1alpha1.PoweredOnPowerState},
+		{Name: "stop", Schedule: "0 20 * * 1-5", PowerState: vmv1alpha1.PoweredOffPowerState},
+	}
+	schedules := make([]cron.Schedule, len(actions))
+	for i, a := range actions {
+		var err error
+		if schedules[i], err = cron.ParseStandard(a.Schedule); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tuesday, September 1st 2020
+	at := func(loc *time.Location, day, hour, min int) time.Time {
+		return time.Date(2020, 9, day, hour, min, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name      string
+		last, now time.Time
+		want      string
+		wantTime  time.Time
+	}{
+		{
+			name: "none due",
+			last: at(time.UTC, 1, 8, 0),
+			now:  at(time.UTC, 1, 12, 0),
+		},
+		{
+			name:     "single action due",
+			last:     at(time.UTC, 1, 8, 0),
+			now:      at(time.UTC, 1, 20, 30),
+			want:     "stop",
+			wantTime: at(time.UTC, 1, 20, 0),
+		},
+		{
+			name:     "latest of several due actions",
+			last:     at(time.UTC, 1, 7, 0),
+			now:      at(time.UTC, 2, 9, 0),
+			want:     "start",
+			wantTime: at(time.UTC, 2, 8, 0),
+		},
+		{
+			name: "weekend skipped",
+			last: at(time.UTC, 4, 20, 0),
+			now:  at(time.UTC, 7, 7, 0),
+		},
+		{
+			name:     "schedules in time zone",
+			last:     at(time.UTC, 1, 5, 0).In(berlin),
+			now:      at(time.UTC, 1, 6, 30).In(berlin),
+			want:     "start",
+			wantTime: at(berlin, 1, 8, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			due, dueTime := dueAction(actions, schedules, tt.last, tt.now)
+
+			got := ""
+			if due != nil {
+				got = due.Name
+			}
+			if got != tt.want || !dueTime.Equal(tt.wantTime) {
+				t.Errorf("dueAction() = %q at %v, want %q at %v", got, dueTime, tt.want, tt.wantTime)
+			}
+		})
+	}
+}
@@ -0,0 +1,448 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"golang.org/x/sync/errgroup"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	vmv1alpha1 "codeconnect/operator/api/v1alpha1"
+)
+
+// VmGroupSnapshotReconciler reconciles a VmGroupSnapshot object
+type VmGroupSnapshotReconciler struct {
+	client.Client
+	Finder   *find.Finder
+	Limiter  *Limiter // shared with the VmGroupReconciler
+	Timeouts Timeouts
+	Context  context.Context // cancelled on shutdown
+	Paused   bool            // pause changes to all VmGroups
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=vm.codeconnect.vmworld.com,resources=vmgroupsnapshots,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=vm.codeconnect.vmworld.com,resources=vmgroupsnapshots/status,verbs=get;update;patch
+
+// Reconcile snapshots all replicas of the referenced VmGroup once or on a
+// schedule. Snapshots are removed from the replicas when the VmGroupSnapshot
+// is deleted.
+func (r *VmGroupSnapshotReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx, cancel := context.WithTimeout(r.Context, r.Timeouts.Reconcile)
+	defer cancel()
+
+	log := r.Log.WithValues("vmgroupsnapshot", req.NamespacedName)
+
+	vs := &vmv1alpha1.VmGroupSnapshot{}
+	if err := r.Client.Get(ctx, req.NamespacedName, vs); err != nil {
+		if !k8serr.IsNotFound(err) {
+			log.Error(err, "unable to fetch VmGroupSnapshot")
+		}
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	msg := fmt.Sprintf("received reconcile request for %q (namespace: %q)", vs.GetName(), vs.GetNamespace())
+	log.Info(msg)
+
+	paused, err := r.paused(ctx, vs)
+	if err != nil {
+		log.Error(err, "could not get VmGroup")
+		return ctrl.Result{}, err
+	}
+
+	if !vs.ObjectMeta.DeletionTimestamp.IsZero() {
+		if containsString(vs.ObjectMeta.Finalizers, finalizerID) {
+			if paused {
+				log.Info("VmGroup paused, deferring removal of snapshots")
+				return ctrl.Result{RequeueAfter: defaultRequeue}, nil
+			}
+
+			if err := r.removeSnapshots(ctx, vs, vs.Status.Snapshots); err != nil {
+				return ctrl.Result{}, err
+			}
+
+			vs.ObjectMeta.Finalizers = removeString(vs.ObjectMeta.Finalizers, finalizerID)
+			if err := r.Update(ctx, vs); err != nil {
+				return ctrl.Result{}, errors.Wrap(err, "could not remove finalizer")
+			}
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if !containsString(vs.ObjectMeta.Finalizers, finalizerID) {
+		vs.ObjectMeta.Finalizers = append(vs.ObjectMeta.Finalizers, finalizerID)
+		if err := r.Update(ctx, vs); err != nil {
+			return ctrl.Result{}, errors.Wrap(err, "could not add finalizer")
+		}
+	}
+
+	if paused {
+		msg := "VmGroup paused, not changing snapshots"
+		if r.Paused {
+			msg = "all VmGroups paused, not changing snapshots"
+		}
+		log.Info(msg)
+
+		vs.Status.Phase = vmv1alpha1.PausedStatusPhase
+		vs.Status.LastMessage = msg
+		return ctrl.Result{RequeueAfter: defaultRequeue}, updateStatus(r.Client, vs)
+	}
+
+	vms, err := r.getReplicas(ctx, vs)
+	if err != nil {
+		msg := "could not get replicas of VmGroup"
+		log.Error(err, msg)
+
+		vs.Status.Phase = vmv1alpha1.PendingStatusPhase
+		vs.Status.LastMessage = msg + ": " + err.Error()
+		return ctrl.Result{RequeueAfter: defaultRequeue}, updateStatus(r.Client, vs)
+	}
+
+	now := time.Now()
+	result := ctrl.Result{}
+	name := vs.Spec.SnapshotName
+	if name == "" {
+		name = vs.Name
+	}
+
+	var taken *vmv1alpha1.GroupSnapshot
+	if vs.Spec.Schedule == "" {
+		if len(vs.Status.Snapshots) == 0 {
+			taken = r.snapshotReplicas(ctx, vs, vms, name)
+			vs.Status.Snapshots = append(vs.Status.Snapshots, *taken)
+		} else {
+			// retry replicas the snapshot failed on
+			taken = &vs.Status.Snapshots[0]
+			r.retrySnapshot(ctx, vs, vms, taken)
+		}
+
+		if countFailed(taken.VMs) > 0 {
+			result.RequeueAfter = defaultRequeue
+		}
+	} else {
+		schedule, err := cron.ParseStandard(vs.Spec.Schedule)
+		if err != nil {
+			msg := "invalid schedule"
+			log.Error(err, msg)
+
+			vs.Status.Phase = vmv1alpha1.ErrorStatusPhase
+			vs.Status.LastMessage = msg + ": " + err.Error()
+
+			// ignoring this VmGroupSnapshot until the spec is fixed
+			return ctrl.Result{}, updateStatus(r.Client, vs)
+		}
+
+		last := vs.CreationTimestamp.Time
+		if vs.Status.LastScheduleTime != nil {
+			last = vs.Status.LastScheduleTime.Time
+		}
+
+		if !schedule.Next(last).After(now) {
+			taken = r.snapshotReplicas(ctx, vs, vms, name+"-"+now.UTC().Format(archiveTimestampFormat))
+			vs.Status.Snapshots = append(vs.Status.Snapshots, *taken)
+			vs.Status.LastScheduleTime = &metav1.Time{Time: now}
+		}
+
+		next := schedule.Next(now)
+		vs.Status.NextScheduleTime = &metav1.Time{Time: next}
+		result.RequeueAfter = next.Sub(now)
+	}
+
+	vs.Status.Phase = vmv1alpha1.RunningStatusPhase
+	vs.Status.LastMessage = "successfully reconciled VmGroupSnapshot"
+
+	if taken != nil {
+		if failed := countFailed(taken.VMs); failed > 0 {
+			vs.Status.Phase = vmv1alpha1.ErrorStatusPhase
+			vs.Status.LastMessage = fmt.Sprintf("snapshot %q failed on %d of %d replica(s)", taken.Name, failed, len(taken.VMs))
+		}
+	}
+
+	// delete the oldest scheduled snapshots exceeding the retention
+	if vs.Spec.Schedule != "" && vs.Spec.Retention > 0 && len(vs.Status.Snapshots) > int(vs.Spec.Retention) {
+		expired := vs.Status.Snapshots[:len(vs.Status.Snapshots)-int(vs.Spec.Retention)]
+		if err = r.removeSnapshots(ctx, vs, expired); err != nil {
+			msg := "could not remove expired snapshots"
+			log.Error(err, msg)
+
+			vs.Status.Phase = vmv1alpha1.PendingStatusPhase
+			vs.Status.LastMessage = msg + ": " + err.Error()
+			return ctrl.Result{RequeueAfter: defaultRequeue}, updateStatus(r.Client, vs)
+		}
+		vs.Status.Snapshots = vs.Status.Snapshots[len(expired):]
+	}
+
+	// reverts are one-shot, acknowledged in status until revertTo is cleared
+	if vs.Spec.RevertTo == "" {
+		vs.Status.RevertedTo = ""
+	} else if vs.Spec.RevertTo != vs.Status.RevertedTo {
+		s := getSnapshot(vs.Status.Snapshots, vs.Spec.RevertTo)
+		if s == nil {
+			msg := "invalid revertTo"
+			err := errors.Errorf("snapshot %q not found", vs.Spec.RevertTo)
+			log.Error(err, msg)
+
+			vs.Status.Phase = vmv1alpha1.ErrorStatusPhase
+			vs.Status.LastMessage = msg + ": " + err.Error()
+
+			// ignoring the revert until the spec is fixed
+			return result, updateStatus(r.Client, vs)
+		}
+
+		// replicas created since or the snapshot failed on have nothing to
+		// revert to
+		revert, skipped := snapshotted(s, vms)
+		msg := fmt.Sprintf("reverting %d replica(s) to snapshot %q", len(revert), vs.Spec.RevertTo)
+		if len(skipped) > 0 {
+			msg += fmt.Sprintf(", %d replica(s) not in snapshot: %s", len(skipped), strings.Join(skipped, ", "))
+		}
+		log.Info(msg)
+
+		if err = r.revertReplicas(ctx, vs.Namespace, revert, vs.Spec.RevertTo); err != nil {
+			msg := "could not revert replicas"
+			log.Error(err, msg)
+
+			vs.Status.Phase = vmv1alpha1.PendingStatusPhase
+			vs.Status.LastMessage = msg + ": " + err.Error()
+			return ctrl.Result{RequeueAfter: defaultRequeue}, updateStatus(r.Client, vs)
+		}
+		vs.Status.RevertedTo = vs.Spec.RevertTo
+		vs.Status.LastMessage = msg
+	}
+
+	return result, updateStatus(r.Client, vs)
+}
+
+// paused returns true if changes to the replicas of the referenced VmGroup
+// are paused, either in its spec or for all VmGroups. A deleted VmGroup is not
+// paused.
+func (r *VmGroupSnapshotReconciler) paused(ctx context.Context, vs *vmv1alpha1.VmGroupSnapshot) (bool, error) {
+	if r.Paused {
+		return true, nil
+	}
+
+	vg := &vmv1alpha1.VmGroup{}
+	key := client.ObjectKey{Namespace: vs.Namespace, Name: vs.Spec.VmGroupRef.Name}
+	if err := r.Client.Get(ctx, key, vg); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	return vg.Spec.Paused, nil
+}
+
+// getReplicas returns the replicas of the referenced VmGroup
+func (r *VmGroupSnapshotReconciler) getReplicas(ctx context.Context, vs *vmv1alpha1.VmGroupSnapshot) ([]*object.VirtualMachine, error) {
+	vg := &vmv1alpha1.VmGroup{}
+	key := client.ObjectKey{Namespace: vs.Namespace, Name: vs.Spec.VmGroupRef.Name}
+	if err := r.Client.Get(ctx, key, vg); err != nil {
+		return nil, errors.Wrapf(err, "could not get VmGroup %q", key.Name)
+	}
+
+	return getVmGroupReplicas(ctx, r.Client, r.Finder, vg)
+}
+
+// snapshotReplicas creates the snapshot name on all vms concurrently, bounded
+// by the Limiter
+func (r *VmGroupSnapshotReconciler) snapshotReplicas(ctx context.Context, vs *vmv1alpha1.VmGroupSnapshot, vms []*object.VirtualMachine, name string) *vmv1alpha1.GroupSnapshot {
+	msg := fmt.Sprintf("creating snapshot %q on %d replica(s)", name, len(vms))
+	r.Log.Info(msg, "vmgroupsnapshot", vs.Namespace+"/"+vs.Name)
+
+	taken := &vmv1alpha1.GroupSnapshot{
+		Name:      name,
+		CreatedAt: metav1.Now(),
+		VMs:       make([]vmv1alpha1.VmSnapshotStatus, len(vms)),
+	}
+
+	var eg errgroup.Group
+	for i := range vms {
+		i := i
+		eg.Go(func() error {
+			status := vmv1alpha1.VmSnapshotStatus{VM: vms[i].Name(), Ready: true}
+			if err := r.snapshotReplica(ctx, vs, vms[i], name); err != nil {
+				status.Ready = false
+				status.Message = err.Error()
+			}
+			taken.VMs[i] = status
+			return nil
+		})
+	}
+	_ = eg.Wait()
+
+	return taken
+}
+
+// snapshotReplica creates the snapshot name of vm
+func (r *VmGroupSnapshotReconciler) snapshotReplica(ctx context.Context, vs *vmv1alpha1.VmGroupSnapshot, vm *object.VirtualMachine, name string) error {
+	return r.withSnapshotBudget(ctx, vs.Namespace, func(ctx context.Context) error {
+		return createSnapshot(ctx, vm, name, vs.Spec.Memory, vs.Spec.Quiesce)
+	})
+}
+
+// withSnapshotBudget runs the snapshot operation fn once the Limiter grants a
+// token for namespace, bounded by the snapshot timeout
+func (r *VmGroupSnapshotReconciler) withSnapshotBudget(ctx context.Context, namespace string, fn func(context.Context) error) error {
+	if err := r.Limiter.acquire(ctx, snapshotOperation, namespace); err != nil {
+		return err
+	}
+	defer r.Limiter.release(snapshotOperation)
+
+	ctx, cancel := context.WithTimeout(ctx, r.Timeouts.Snapshot)
+	defer cancel()
+
+	return fn(ctx)
+}
+
+// retrySnapshot creates the snapshot s on the vms it failed on and updates
+// their status in s. Failed replicas deleted since are removed from s.
+func (r *VmGroupSnapshotReconciler) retrySnapshot(ctx context.Context, vs *vmv1alpha1.VmGroupSnapshot, vms []*object.VirtualMachine, s *vmv1alpha1.GroupSnapshot) {
+	existing := make(map[string]*object.VirtualMachine, len(vms))
+	for _, vm := range vms {
+		existing[vm.Name()] = vm
+	}
+
+	var (
+		statuses []vmv1alpha1.VmSnapshotStatus
+		retry    []*object.VirtualMachine
+	)
+	for _, status := range s.VMs {
+		if !status.Ready {
+			vm, ok := existing[status.VM]
+			if !ok {
+				continue
+			}
+			retry = append(retry, vm)
+		}
+		statuses = append(statuses, status)
+	}
+	s.VMs = statuses
+
+	if len(retry) == 0 {
+		return
+	}
+
+	taken := r.snapshotReplicas(ctx, vs, retry, s.Name)
+	for _, status := range taken.VMs {
+		for i := range s.VMs {
+			if s.VMs[i].VM == status.VM {
+				s.VMs[i] = status
+			}
+		}
+	}
+}
+
+// revertReplicas reverts all vms to the snapshot name
+func (r *VmGroupSnapshotReconciler) revertReplicas(ctx context.Context, namespace string, vms []*object.VirtualMachine, name string) error {
+	eg, egCtx := errgroup.WithContext(ctx)
+	for i := range vms {
+		vm := vms[i]
+		eg.Go(func() error {
+			return r.withSnapshotBudget(egCtx, namespace, func(ctx context.Context) error {
+				return revertSnapshot(ctx, vm, name)
+			})
+		})
+	}
+	return eg.Wait()
+}
+
+// removeSnapshots removes snapshots from the replicas of the referenced
+// VmGroup. Replicas or VmGroups already deleted are ignored.
+func (r *VmGroupSnapshotReconciler) removeSnapshots(ctx context.Context, vs *vmv1alpha1.VmGroupSnapshot, snapshots []vmv1alpha1.GroupSnapshot) error {
+	var nfe *find.NotFoundError
+
+	vms, err := r.getReplicas(ctx, vs)
+	if err != nil {
+		if k8serr.IsNotFound(errors.Cause(err)) || errors.As(err, &nfe) {
+			return nil
+		}
+		return err
+	}
+
+	for _, s := range snapshots {
+		msg := fmt.Sprintf("removing snapshot %q from %d replica(s)", s.Name, len(vms))
+		r.Log.Info(msg, "vmgroupsnapshot", vs.Namespace+"/"+vs.Name)
+
+		for _, vm := range vms {
+			err = r.withSnapshotBudget(ctx, vs.Namespace, func(ctx context.Context) error {
+				return removeSnapshot(ctx, vm, s.Name)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func getSnapshot(snapshots []vmv1alpha1.GroupSnapshot, name string) *vmv1alpha1.GroupSnapshot {
+	for i := range snapshots {
+		if snapshots[i].Name == name {
+			return &snapshots[i]
+		}
+	}
+	return nil
+}
+
+// snapshotted returns the vms with a ready snapshot s and the names of the
+// others
+func snapshotted(s *vmv1alpha1.GroupSnapshot, vms []*object.VirtualMachine) ([]*object.VirtualMachine, []string) {
+	ready := make(map[string]bool, len(s.VMs))
+	for _, status := range s.VMs {
+		ready[status.VM] = status.Ready
+	}
+
+	var (
+		revert  []*object.VirtualMachine
+		skipped []string
+	)
+	for _, vm := range vms {
+		if ready[vm.Name()] {
+			revert = append(revert, vm)
+		} else {
+			skipped = append(skipped, vm.Name())
+		}
+	}
+	return revert, skipped
+}
+
+func countFailed(vms []vmv1alpha1.VmSnapshotStatus) int {
+	n := 0
+	for _, vm := range vms {
+		if !vm.Ready {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *VmGroupSnapshotReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&vmv1alpha1.VmGroupSnapshot{}).
+		Complete(r)
+}
@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vmware/govmomi/object"
+
+	vmv1alpha1 "codeconnect/operator/api/v1alpha1"
+)
+
+func TestSnapshotted(t *testing.T) {
+	s := &vmv1alpha1.GroupSnapshot{
+		Name: "s",
+		VMs: []vmv1alpha1.VmSnapshotStatus{
+			{VM: "vg-replica-1", Ready: true},
+			{VM: "vg-replica-2", Ready: false, Message: "could not create snapshot"},
+			{VM: "vg-replica-3", Ready: true},
+		},
+	}
+
+	names := func(vms []*object.VirtualMachine) []string {
+		var n []string
+		for _, vm := range vms {
+			n = append(n, vm.Name())
+		}
+		return n
+	}
+
+	tests := []struct {
+		name        string
+		vms         []string
+		wantRevert  []string
+		wantSkipped []string
+	}{
+		{
+			name:       "all in snapshot",
+			vms:        []string{"vg-replica-1", "vg-replica-3"},
+			wantRevert: []string{"vg-replica-1", "vg-replica-3"},
+		},
+		{
+			name:        "snapshot failed",
+			vms:         []string{"vg-replica-1", "vg-replica-2"},
+			wantRevert:  []string{"vg-replica-1"},
+			wantSkipped: []string{"vg-replica-2"},
+		},
+		{
+			name:        "created after snapshot",
+			vms:         []string{"vg-replica-1", "vg-replica-4"},
+			wantRevert:  []string{"vg-replica-1"},
+			wantSkipped: []string{"vg-replica-4"},
+		},
+		{
+			name:       "deleted after snapshot",
+			vms:        []string{"vg-replica-3"},
+			wantRevert: []string{"vg-replica-3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var vms []*object.VirtualMachine
+			for _, name := range tt.vms {
+				vm := testVM(name)
+				vm.InventoryPath = "/dc/vm/vg/" + name
+				vms = append(vms, vm)
+			}
+
+			revert, skipped := snapshotted(s, vms)
+			if got := names(revert); !reflect.DeepEqual(got, tt.wantRevert) {
+				t.Errorf("revert = %v, want %v", got, tt.wantRevert)
+			}
+			if !reflect.DeepEqual(skipped, tt.wantSkipped) {
+				t.Errorf("skipped = %v, want %v", skipped, tt.wantSkipped)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	vmv1alpha1 "codeconnect/operator/api/v1alpha1"
+)
+
+// VmNamespaceConfigReconciler reconciles a VmNamespaceConfig object
+type VmNamespaceConfigReconciler struct {
+	client.Client
+	Finder       *find.Finder
+	ResourcePool *object.ResourcePool // default parent of namespace pools
+	Timeouts     Timeouts
+	Context      context.Context // cancelled on shutdown
+	Log          logr.Logger
+	Scheme       *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=vm.codeconnect.vmworld.com,resources=vmnamespaceconfigs,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=vm.codeconnect.vmworld.com,resources=vmnamespaceconfigs/status,verbs=get;update;patch
+
+// Reconcile creates the folder and resource pool of the namespace and keeps
+// the resource pool limits in sync. The VmNamespaceConfig cannot be deleted
+// while VmGroups exist in the namespace. The folder and resource pool are not
+// deleted from vCenter.
+func (r *VmNamespaceConfigReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx, cancel := context.WithTimeout(r.Context, r.Timeouts.Reconcile)
+	defer cancel()
+
+	log := r.Log.WithValues("vmnamespaceconfig", req.Name)
+
+	nc := &vmv1alpha1.VmNamespaceConfig{}
+	if err := r.Client.Get(ctx, req.NamespacedName, nc); err != nil {
+		if !k8serr.IsNotFound(err) {
+			log.Error(err, "unable to fetch VmNamespaceConfig")
+		}
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	msg := fmt.Sprintf("received reconcile request for %q", nc.GetName())
+	log.Info(msg)
+
+	if !nc.ObjectMeta.DeletionTimestamp.IsZero() {
+		if containsString(nc.ObjectMeta.Finalizers, finalizerID) {
+			var groups vmv1alpha1.VmGroupList
+			if err := r.List(ctx, &groups, client.InNamespace(nc.Name)); err != nil {
+				return ctrl.Result{}, errors.Wrap(err, "could not list VmGroups")
+			}
+
+			// VmGroups would lose track of their replicas in the namespace folder
+			if len(groups.Items) > 0 {
+				nc.Status.Phase = vmv1alpha1.PendingStatusPhase
+				nc.Status.LastMessage = fmt.Sprintf("waiting for %d VmGroup(s) in namespace to be deleted", len(groups.Items))
+				return ctrl.Result{RequeueAfter: defaultRequeue}, updateStatus(r.Client, nc)
+			}
+
+			nc.ObjectMeta.Finalizers = removeString(nc.ObjectMeta.Finalizers, finalizerID)
+			if err := r.Update(ctx, nc); err != nil {
+				return ctrl.Result{}, errors.Wrap(err, "could not remove finalizer")
+			}
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if !containsString(nc.ObjectMeta.Finalizers, finalizerID) {
+		nc.ObjectMeta.Finalizers = append(nc.ObjectMeta.Finalizers, finalizerID)
+		if err := r.Update(ctx, nc); err != nil {
+			return ctrl.Result{}, errors.Wrap(err, "could not add finalizer")
+		}
+	}
+
+	folder := namespaceFolder(nc)
+	if err := ensureFolder(ctx, r.Finder, folder); err != nil {
+		msg := "could not create namespace folder"
+		log.Error(err, msg)
+
+		nc.Status.Phase = vmv1alpha1.PendingStatusPhase
+		nc.Status.LastMessage = msg + ": " + err.Error()
+		return ctrl.Result{RequeueAfter: defaultRequeue}, updateStatus(r.Client, nc)
+	}
+
+	pool := namespacePool(nc, r.ResourcePool)
+	if err := ensureResourcePool(ctx, r.Finder, pool, nc.Spec.ResourcePool); err != nil {
+		msg := "could not update namespace resource pool"
+		log.Error(err, msg)
+
+		nc.Status.Phase = vmv1alpha1.PendingStatusPhase
+		nc.Status.LastMessage = msg + ": " + err.Error()
+		return ctrl.Result{RequeueAfter: defaultRequeue}, updateStatus(r.Client, nc)
+	}
+
+	nc.Status.Phase = vmv1alpha1.RunningStatusPhase
+	nc.Status.Folder = folder
+	nc.Status.ResourcePool = pool
+	nc.Status.LastMessage = "successfully reconciled VmNamespaceConfig"
+	return ctrl.Result{}, updateStatus(r.Client, nc)
+}
+
+// ensureFolder creates the folder at the inventory path p if it does not exist
+func ensureFolder(ctx context.Context, finder *find.Finder, p string) error {
+	var nfe *find.NotFoundError
+
+	_, err := finder.Folder(ctx, p)
+	if err == nil {
+		return nil
+	}
+	if !errors.As(err, &nfe) {
+		return errors.Wrapf(err, "could not get folder %q", p)
+	}
+
+	parent, err := finder.Folder(ctx, path.Dir(p))
+	if err != nil {
+		return errors.Wrapf(err, "could not get parent folder of %q", p)
+	}
+
+	_, err = parent.CreateFolder(ctx, path.Base(p))
+	return errors.Wrapf(err, "could not create folder %q", p)
+}
+
+// ensureResourcePool creates the resource pool at the inventory path p if it
+// does not exist and sets the limits in spec
+func ensureResourcePool(ctx context.Context, finder *find.Finder, p string, spec *vmv1alpha1.NamespaceResourcePool) error {
+	var nfe *find.NotFoundError
+
+	config := types.DefaultResourceConfigSpec()
+	if spec != nil && spec.CPULimit != nil {
+		config.CpuAllocation.Limit = spec.CPULimit
+	}
+	if spec != nil && spec.MemoryLimit != nil {
+		config.MemoryAllocation.Limit = spec.MemoryLimit
+	}
+
+	rp, err := finder.ResourcePool(ctx, p)
+	if err == nil {
+		var current mo.ResourcePool
+		if err = rp.Properties(ctx, rp.Reference(), []string{"config"}, &current); err != nil {
+			return errors.Wrapf(err, "could not get config of resource pool %q", p)
+		}
+		if allocationEqual(current.Config.CpuAllocation, config.CpuAllocation) &&
+			allocationEqual(current.Config.MemoryAllocation, config.MemoryAllocation) {
+			return nil
+		}
+		return errors.Wrapf(rp.UpdateConfig(ctx, "", &config), "could not update resource pool %q", p)
+	}
+	if !errors.As(err, &nfe) {
+		return errors.Wrapf(err, "could not get resource pool %q", p)
+	}
+
+	parent, err := finder.ResourcePool(ctx, path.Dir(p))
+	if err != nil {
+		return errors.Wrapf(err, "could not get parent resource pool of %q", p)
+	}
+
+	_, err = parent.Create(ctx, path.Base(p), config)
+	return errors.Wrapf(err, "could not create resource pool %q", p)
+}
+
+// allocationEqual returns true if the allocation fields set by
+// ensureResourcePool are equal
+func allocationEqual(a, b types.ResourceAllocationInfo) bool {
+	return int64Equal(a.Reservation, b.Reservation) &&
+		int64Equal(a.Limit, b.Limit) &&
+		boolEqual(a.ExpandableReservation, b.ExpandableReservation) &&
+		(a.Shares == nil) == (b.Shares == nil) &&
+		(a.Shares == nil || a.Shares.Level == b.Shares.Level)
+}
+
+func int64Equal(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func boolEqual(a, b *bool) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func (r *VmNamespaceConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&vmv1alpha1.VmNamespaceConfig{}).
+		Complete(r)
+}
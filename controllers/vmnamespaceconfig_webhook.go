@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	vmv1alpha1 "codeconnect/operator/api/v1alpha1"
+)
+
+// VmNamespaceConfigValidatorPath is the path the VmNamespaceConfigValidator is
+// served on
+const VmNamespaceConfigValidatorPath = "/validate-vm-codeconnect-vmworld-com-v1alpha1-vmnamespaceconfig"
+
+// +kubebuilder:webhook:path=/validate-vm-codeconnect-vmworld-com-v1alpha1-vmnamespaceconfig,mutating=false,failurePolicy=fail,groups=vm.codeconnect.vmworld.com,resources=vmnamespaceconfigs,verbs=create;update,versions=v1alpha1,name=vvmnamespaceconfig.codeconnect.vmworld.com
+
+// VmNamespaceConfigValidator rejects VmNamespaceConfigs moving the folder of a
+// namespace with VmGroups. Existing VmGroups keep their folder, new VmGroups
+// would be placed in a different folder.
+type VmNamespaceConfigValidator struct {
+	Client  client.Client
+	decoder *admission.Decoder
+}
+
+// Handle validates VmNamespaceConfigs on create and update
+func (v *VmNamespaceConfigValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	nc := &vmv1alpha1.VmNamespaceConfig{}
+	if err := v.decoder.Decode(req, nc); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	// deletion waits for the VmGroups of the namespace
+	if !nc.ObjectMeta.DeletionTimestamp.IsZero() {
+		return admission.Allowed("")
+	}
+
+	if req.Operation == admissionv1beta1.Update {
+		old := &vmv1alpha1.VmNamespaceConfig{}
+		if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if namespaceFolder(old) == namespaceFolder(nc) {
+			return admission.Allowed("")
+		}
+	}
+
+	var groups vmv1alpha1.VmGroupList
+	if err := v.Client.List(ctx, &groups, client.InNamespace(nc.Name)); err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	if len(groups.Items) > 0 {
+		return admission.Denied(fmt.Sprintf("namespace %q has %d VmGroup(s), the namespace folder cannot be changed while VmGroups exist", nc.Name, len(groups.Items)))
+	}
+	return admission.Allowed("")
+}
+
+// InjectDecoder implements admission.DecoderInjector
+func (v *VmNamespaceConfigValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
@@ -0,0 +1,113 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	vmv1alpha1 "codeconnect/operator/api/v1alpha1"
+)
+
+// VmQuotaReconciler reconciles a VmQuota object
+type VmQuotaReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=vm.codeconnect.vmworld.com,resources=vmquotas,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=vm.codeconnect.vmworld.com,resources=vmquotas/status,verbs=get;update;patch
+
+// Reconcile records the resources used by all VmGroups in the namespace of the
+// VmQuota. Quotas are enforced by the VmGroupValidator and VmGroupReconciler.
+func (r *VmQuotaReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("vmquota", req.NamespacedName)
+
+	vq := &vmv1alpha1.VmQuota{}
+	if err := r.Client.Get(ctx, req.NamespacedName, vq); err != nil {
+		if !k8serr.IsNotFound(err) {
+			log.Error(err, "unable to fetch VmQuota")
+		}
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	msg := fmt.Sprintf("received reconcile request for %q (namespace: %q)", vq.GetName(), vq.GetNamespace())
+	log.Info(msg)
+
+	var groups vmv1alpha1.VmGroupList
+	if err := r.List(ctx, &groups, client.InNamespace(vq.Namespace)); err != nil {
+		msg := "could not list VmGroups"
+		log.Error(err, msg)
+
+		vq.Status.Phase = vmv1alpha1.PendingStatusPhase
+		vq.Status.LastMessage = msg + ": " + err.Error()
+		return ctrl.Result{RequeueAfter: defaultRequeue}, errors.Wrap(r.Client.Status().Update(ctx, vq), "could not update status")
+	}
+
+	used := namespaceQuotaUsage(groups.Items, "")
+	vq.Status.Used = used.resources()
+	vq.Status.Phase = vmv1alpha1.RunningStatusPhase
+	vq.Status.LastMessage = fmt.Sprintf("%d VmGroup(s) within quota", len(groups.Items))
+
+	// e.g. the VmQuota was lowered, existing replicas are not removed
+	if exceeded := quotaViolations(vq.Spec.Hard, used, quotaUsage{}); len(exceeded) > 0 {
+		vq.Status.LastMessage = "quota exceeded: " + strings.Join(exceeded, ", ")
+	}
+
+	return ctrl.Result{}, errors.Wrap(r.Client.Status().Update(ctx, vq), "could not update status")
+}
+
+// groupToQuotas returns a request for each VmQuota in the namespace of the
+// VmGroup so used resources are updated
+func (r *VmQuotaReconciler) groupToQuotas(o handler.MapObject) []reconcile.Request {
+	var list vmv1alpha1.VmQuotaList
+	if err := r.List(context.Background(), &list, client.InNamespace(o.Meta.GetNamespace())); err != nil {
+		r.Log.Error(err, "could not list VmQuotas for VmGroup", "vmgroup", o.Meta.GetNamespace()+"/"+o.Meta.GetName())
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(list.Items))
+	for _, vq := range list.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: k8stypes.NamespacedName{Namespace: vq.Namespace, Name: vq.Name},
+		})
+	}
+	return requests
+}
+
+func (r *VmQuotaReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&vmv1alpha1.VmQuota{}).
+		Watches(&source.Kind{Type: &vmv1alpha1.VmGroup{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.groupToQuotas),
+		}).
+		Complete(r)
+}
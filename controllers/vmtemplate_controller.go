@@ -0,0 +1,138 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/vapi/rest"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	vmv1alpha1 "codeconnect/operator/api/v1alpha1"
+)
+
+// VmTemplateReconciler reconciles a VmTemplate object
+type VmTemplateReconciler struct {
+	client.Client
+	Finder   *find.Finder
+	Rest     *rest.Client // vCenter REST API, e.g. content library
+	Timeouts Timeouts
+	Context  context.Context // cancelled on shutdown
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=vm.codeconnect.vmworld.com,resources=vmtemplates,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=vm.codeconnect.vmworld.com,resources=vmtemplates/status,verbs=get;update;patch
+
+// Reconcile validates all versions of a VmTemplate exist in vCenter and
+// records their checksums. The promoted version is only activated once it was
+// validated, which triggers a rollout for all VmGroups referencing it.
+func (r *VmTemplateReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx, cancel := context.WithTimeout(r.Context, r.Timeouts.Reconcile)
+	defer cancel()
+
+	log := r.Log.WithValues("vmtemplate", req.NamespacedName)
+
+	vt := &vmv1alpha1.VmTemplate{}
+	if err := r.Client.Get(ctx, req.NamespacedName, vt); err != nil {
+		if !k8serr.IsNotFound(err) {
+			log.Error(err, "unable to fetch VmTemplate")
+		}
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	msg := fmt.Sprintf("received reconcile request for %q (namespace: %q)", vt.GetName(), vt.GetNamespace())
+	log.Info(msg)
+
+	var promoted *vmv1alpha1.VmTemplateVersionStatus
+	versions := make([]vmv1alpha1.VmTemplateVersionStatus, len(vt.Spec.Versions))
+	for i, v := range vt.Spec.Versions {
+		versions[i] = r.validateVersion(ctx, v)
+		if v.Name == vt.Spec.Promoted {
+			promoted = &versions[i]
+		}
+	}
+
+	status := vt.Status
+	status.Versions = versions
+
+	switch {
+	case promoted == nil:
+		status.Phase = vmv1alpha1.ErrorStatusPhase
+		status.LastMessage = fmt.Sprintf("promoted version %q not found in versions", vt.Spec.Promoted)
+	case !promoted.Ready:
+		// keep the previous version active
+		status.Phase = vmv1alpha1.ErrorStatusPhase
+		status.LastMessage = fmt.Sprintf("promoted version %q is not ready: %s", promoted.Name, promoted.Message)
+	default:
+		if status.PromotedVersion != promoted.Name || status.Checksum != promoted.Checksum {
+			log.Info(fmt.Sprintf("activating version %q (checksum %s)", promoted.Name, promoted.Checksum))
+		}
+		status.Phase = vmv1alpha1.RunningStatusPhase
+		status.PromotedVersion = promoted.Name
+		status.Checksum = promoted.Checksum
+		status.LastMessage = "successfully reconciled VmTemplate"
+	}
+
+	vt.Status = status
+	return ctrl.Result{}, updateStatus(r.Client, vt)
+}
+
+func (r *VmTemplateReconciler) validateVersion(ctx context.Context, v vmv1alpha1.VmTemplateVersion) vmv1alpha1.VmTemplateVersionStatus {
+	status := vmv1alpha1.VmTemplateVersionStatus{
+		Name: v.Name,
+	}
+
+	var (
+		sum string
+		err error
+	)
+
+	switch countSet(v.Template != "", v.ContentLibrary != nil) {
+	case 1:
+		if v.ContentLibrary != nil {
+			sum, err = getLibraryItemChecksum(ctx, r.Rest, v.ContentLibrary)
+		} else {
+			sum, err = getTemplateChecksum(ctx, r.Finder, v.Template)
+		}
+	default:
+		err = errors.New("exactly one of template or contentLibrary must be set")
+	}
+
+	if err != nil {
+		status.Message = err.Error()
+		return status
+	}
+
+	status.Checksum = sum
+	status.Ready = true
+	return status
+}
+
+func (r *VmTemplateReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&vmv1alpha1.VmTemplate{}).
+		Complete(r)
+}
@@ -3,11 +3,17 @@ package controllers
 import (
 	"context"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/vmware/govmomi/find"
 	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vapi/rest"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/mo"
 	"github.com/vmware/govmomi/vim25/types"
+	"go.opentelemetry.io/otel/api/kv"
 
 	"codeconnect/operator/api/v1alpha1"
 )
@@ -17,12 +23,20 @@ const (
 	vmPath = "/vcqaDC/vm/vm-operator"
 	// underlying SOAP error is not typed, thus ugly grepping hack
 	alreadyDeletedErr = "has already been deleted or has not been completely created"
-	// max number parallel vCenter operations
-	defaultConcurrency = 3
+	// snapshot of the template used for linked clones
+	defaultTemplateSnapshot = "vm-operator-linked-clone"
+	// FindSnapshot errors are not typed either
+	snapshotNotFoundErr = "not found"
+	noSnapshotsErr      = "no snapshots for this VM"
+	// timeout for cancelling a task after its context is done
+	cancelTaskTimeout = 30 * time.Second
 )
 
-func getVMGroup(ctx context.Context, finder *find.Finder, vmgroup string) (*object.Folder, error) {
-	path := vmPath + "/" + vmgroup
+func getVMGroup(ctx context.Context, finder *find.Finder, parent, vmgroup string) (_ *object.Folder, err error) {
+	ctx, span := startSpan(ctx, "getVMGroup")
+	defer func() { endSpan(span, err) }()
+
+	path := parent + "/" + vmgroup
 	f, err := finder.Folder(ctx, path)
 	if err != nil {
 		return nil, errors.Wrapf(err, "could not retrieve vm group %q", vmgroup)
@@ -31,10 +45,13 @@ func getVMGroup(ctx context.Context, finder *find.Finder, vmgroup string) (*obje
 	return f, nil
 }
 
-func createVMGroup(ctx context.Context, finder *find.Finder, vmgroup string) (*object.Folder, error) {
-	f, err := finder.Folder(ctx, vmPath)
+func createVMGroup(ctx context.Context, finder *find.Finder, parent, vmgroup string) (_ *object.Folder, err error) {
+	ctx, span := startSpan(ctx, "createVMGroup")
+	defer func() { endSpan(span, err) }()
+
+	f, err := finder.Folder(ctx, parent)
 	if err != nil {
-		return nil, errors.Wrap(err, "could not get vm-operator folder")
+		return nil, errors.Wrapf(err, "could not get parent folder %q", parent)
 	}
 
 	group, err := f.CreateFolder(ctx, vmgroup)
@@ -45,17 +62,40 @@ func createVMGroup(ctx context.Context, finder *find.Finder, vmgroup string) (*o
 	return group, nil
 }
 
-func getReplicas(ctx context.Context, finder *find.Finder, group string) ([]*object.VirtualMachine, error) {
-	g, err := finder.Folder(ctx, vmPath+"/"+group)
+func getReplicas(ctx context.Context, finder *find.Finder, parent, group string) (_ []*object.VirtualMachine, err error) {
+	ctx, span := startSpan(ctx, "getReplicas")
+	defer func() { endSpan(span, err) }()
+
+	g, err := finder.Folder(ctx, parent+"/"+group)
 	if err != nil {
 		return nil, errors.Wrapf(err, "could not find vm group %q", group)
 	}
 
-	return finder.VirtualMachineList(ctx, g.InventoryPath+"/*")
+	vms, err := finder.VirtualMachineList(ctx, g.InventoryPath+"/*")
+	if err != nil {
+		var nfe *find.NotFoundError
+		// empty group folder, e.g. scaled to zero
+		if errors.As(err, &nfe) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return vms, nil
 }
 
-func cloneVM(ctx context.Context, finder *find.Finder, template string, name string, destination string, pool *object.ResourcePool, spec v1alpha1.VmGroupSpec) error {
-	tmpl, err := finder.VirtualMachine(ctx, template)
+func cloneVM(ctx context.Context, finder *find.Finder, rc *rest.Client, src *templateSource, name string, destination string, z *zone, host *object.HostSystem, spec v1alpha1.VmGroupSpec) (err error) {
+	defer func(start time.Time) {
+		observeOperation(cloneOperation, start, err)
+	}(time.Now())
+
+	ctx, span := startSpan(ctx, "cloneVM", vmKey.String(name))
+	defer func() { endSpan(span, err) }()
+
+	if src.contentLibrary != nil {
+		return deployLibraryItem(ctx, finder, rc, src, name, destination, z, host, spec)
+	}
+
+	tmpl, err := finder.VirtualMachine(ctx, src.template)
 	if err != nil {
 		return errors.Wrap(err, "could not find template")
 	}
@@ -65,32 +105,202 @@ func cloneVM(ctx context.Context, finder *find.Finder, template string, name str
 		return errors.Wrap(err, "could not find destination folder")
 	}
 
-	rpRef := pool.Reference()
-	cs := types.VirtualMachineCloneSpec{
-		Location: types.VirtualMachineRelocateSpec{
-			Pool: &rpRef,
+	rpRef := z.pool.Reference()
+	location := types.VirtualMachineRelocateSpec{
+		Pool: &rpRef,
+	}
+
+	if host != nil {
+		hostRef := host.Reference()
+		location.Host = &hostRef
+	}
+
+	if z.datastore != nil {
+		dsRef := z.datastore.Reference()
+		location.Datastore = &dsRef
+	}
+
+	if spec.Network != "" {
+		location.DeviceChange, err = networkDeviceChange(ctx, finder, tmpl, spec.Network)
+		if err != nil {
+			return err
+		}
+	}
+
+	var task *object.Task
+	switch getCloneMode(spec) {
+	case v1alpha1.InstantCloneMode:
+		task, err = instantCloneVM(ctx, tmpl, folder, name, location, src.options())
+	case v1alpha1.LinkedCloneMode:
+		var snapshot *types.ManagedObjectReference
+		snapshot, err = tmpl.FindSnapshot(ctx, getTemplateSnapshot(spec))
+		if err != nil {
+			return errors.Wrapf(err, "could not find snapshot for linked clone of template %q", src.template)
+		}
+
+		location.DiskMoveType = string(types.VirtualMachineRelocateDiskMoveOptionsCreateNewChildDiskBacking)
+		task, err = tmpl.Clone(ctx, folder, name, newCloneSpec(location, snapshot, src, spec))
+	default:
+		task, err = tmpl.Clone(ctx, folder, name, newCloneSpec(location, nil, src, spec))
+	}
+	if err != nil {
+		return errors.Wrap(err, "could not initiate clone task")
+	}
+
+	err = waitTask(ctx, task)
+	if err != nil {
+		return errors.Wrapf(err, "could not create clone %q", name)
+	}
+
+	return nil
+}
+
+// networkDeviceChange returns the device change connecting the first NIC of vm
+// to network
+func networkDeviceChange(ctx context.Context, finder *find.Finder, vm *object.VirtualMachine, network string) ([]types.BaseVirtualDeviceConfigSpec, error) {
+	ref, err := finder.Network(ctx, network)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not find network %q", network)
+	}
+
+	backing, err := ref.EthernetCardBackingInfo(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not get backing of network %q", network)
+	}
+
+	devices, err := vm.Device(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not get devices of %q", vm.Name())
+	}
+
+	nics := devices.SelectByType((*types.VirtualEthernetCard)(nil))
+	if len(nics) == 0 {
+		return nil, errors.Errorf("%q has no network adapter", vm.Name())
+	}
+
+	nic := nics[0]
+	nic.GetVirtualDevice().Backing = backing
+	return []types.BaseVirtualDeviceConfigSpec{
+		&types.VirtualDeviceConfigSpec{
+			Operation: types.VirtualDeviceConfigSpecOperationEdit,
+			Device:    nic,
 		},
+	}, nil
+}
+
+func newCloneSpec(location types.VirtualMachineRelocateSpec, snapshot *types.ManagedObjectReference, src *templateSource, spec v1alpha1.VmGroupSpec) types.VirtualMachineCloneSpec {
+	return types.VirtualMachineCloneSpec{
+		Location: location,
 		Config: &types.VirtualMachineConfigSpec{
-			NumCPUs:  spec.CPU,
-			MemoryMB: int64(1024 * spec.Memory),
+			NumCPUs:     spec.CPU,
+			MemoryMB:    int64(1024 * spec.Memory),
+			ExtraConfig: src.options(),
 		},
-		PowerOn: true,
+		PowerOn:  getPowerState(spec) == v1alpha1.PoweredOnPowerState,
+		Snapshot: snapshot,
 	}
+}
+
+// instantCloneVM forks the running parent vm. Instant clones inherit CPU and
+// memory from the parent and are powered on.
+func instantCloneVM(ctx context.Context, parent *object.VirtualMachine, folder *object.Folder, name string, location types.VirtualMachineRelocateSpec, options []types.BaseOptionValue) (_ *object.Task, err error) {
+	ctx, span := startSpan(ctx, "instantCloneVM", vmKey.String(name))
+	defer func() { endSpan(span, err) }()
 
-	task, err := tmpl.Clone(ctx, folder, name, cs)
+	on, err := isPoweredOn(ctx, parent)
 	if err != nil {
-		return errors.Wrap(err, "could not initiate clone task")
+		return nil, errors.Wrapf(err, "could not get power state of instant clone parent %q", parent.InventoryPath)
 	}
 
-	err = task.Wait(ctx)
+	if !on {
+		return nil, errors.Errorf("instant clone parent %q is not powered on", parent.InventoryPath)
+	}
+
+	folderRef := folder.Reference()
+	location.Folder = &folderRef
+
+	req := types.InstantClone_Task{
+		This: parent.Reference(),
+		Spec: types.VirtualMachineInstantCloneSpec{
+			Name:     name,
+			Location: location,
+			Config:   options,
+		},
+	}
+
+	res, err := methods.InstantClone_Task(ctx, parent.Client(), &req)
 	if err != nil {
-		return errors.Wrapf(err, "could not create clone %q", name)
+		return nil, err
 	}
 
+	return object.NewTask(parent.Client(), res.Returnval), nil
+}
+
+// ensureTemplateSnapshot creates the snapshot linked clones are created from if
+// it does not exist
+func ensureTemplateSnapshot(ctx context.Context, finder *find.Finder, template, snapshot string) (err error) {
+	ctx, span := startSpan(ctx, "ensureTemplateSnapshot")
+	defer func() { endSpan(span, err) }()
+
+	tmpl, err := finder.VirtualMachine(ctx, template)
+	if err != nil {
+		return errors.Wrap(err, "could not find template")
+	}
+
+	_, err = tmpl.FindSnapshot(ctx, snapshot)
+	if err == nil {
+		return nil
+	}
+
+	// underlying error is not typed
+	if !isSnapshotNotFound(err) {
+		return errors.Wrapf(err, "could not get snapshot %q of template %q", snapshot, template)
+	}
+
+	task, err := tmpl.CreateSnapshot(ctx, snapshot, "created by vm-operator for linked clones", false, false)
+	if err != nil {
+		return errors.Wrapf(err, "could not initiate snapshot task for template %q", template)
+	}
+
+	err = waitTask(ctx, task)
+	if err != nil {
+		return errors.Wrapf(err, "could not create snapshot %q of template %q", snapshot, template)
+	}
 	return nil
 }
 
-func isPoweredOn(ctx context.Context, vm *object.VirtualMachine) (bool, error) {
+func getCloneMode(spec v1alpha1.VmGroupSpec) v1alpha1.CloneMode {
+	if spec.CloneMode == "" {
+		return v1alpha1.FullCloneMode
+	}
+	return spec.CloneMode
+}
+
+func getPowerState(spec v1alpha1.VmGroupSpec) v1alpha1.PowerState {
+	if spec.PowerState == "" {
+		return v1alpha1.PoweredOnPowerState
+	}
+	return spec.PowerState
+}
+
+func getScaleToZeroPolicy(spec v1alpha1.VmGroupSpec) v1alpha1.ScaleToZeroPolicy {
+	if spec.ScaleToZeroPolicy == "" {
+		return v1alpha1.DeleteScaleToZeroPolicy
+	}
+	return spec.ScaleToZeroPolicy
+}
+
+func getTemplateSnapshot(spec v1alpha1.VmGroupSpec) string {
+	if spec.TemplateSnapshot == "" {
+		return defaultTemplateSnapshot
+	}
+	return spec.TemplateSnapshot
+}
+
+func isPoweredOn(ctx context.Context, vm *object.VirtualMachine) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "isPoweredOn", vmKey.String(vm.Name()))
+	defer func() { endSpan(span, err) }()
+
 	p, err := vm.PowerState(ctx)
 	if err != nil {
 		return false, err
@@ -99,11 +309,114 @@ func isPoweredOn(ctx context.Context, vm *object.VirtualMachine) (bool, error) {
 	return p == types.VirtualMachinePowerStatePoweredOn, nil
 }
 
-func deleteVM(ctx context.Context, vm *object.VirtualMachine) error {
-	task, _ := vm.PowerOff(ctx)
+// isReady returns true if vm is powered on and its guest heartbeat is not red,
+// vms without VMware Tools are ready when powered on. Requires the
+// runtime.powerState and guestHeartbeatStatus properties.
+func isReady(vm mo.VirtualMachine) bool {
+	return vm.Runtime.PowerState == types.VirtualMachinePowerStatePoweredOn && vm.GuestHeartbeatStatus != types.ManagedEntityStatusRed
+}
+
+// countReady returns the number of ready vms
+func countReady(ctx context.Context, vms []*object.VirtualMachine) (_ int32, err error) {
+	ctx, span := startSpan(ctx, "countReady")
+	defer func() { endSpan(span, err) }()
+
+	if len(vms) == 0 {
+		return 0, nil
+	}
+
+	refs := make([]types.ManagedObjectReference, len(vms))
+	for i, vm := range vms {
+		refs[i] = vm.Reference()
+	}
+
+	var mos []mo.VirtualMachine
+	pc := property.DefaultCollector(vms[0].Client())
+	if err := pc.Retrieve(ctx, refs, []string{"runtime.powerState", "guestHeartbeatStatus"}, &mos); err != nil {
+		return 0, errors.Wrap(err, "could not get power state of replicas")
+	}
+
+	var ready int32
+	for _, m := range mos {
+		if isReady(m) {
+			ready++
+		}
+	}
+	return ready, nil
+}
+
+// waitTask waits for the vCenter task to complete. The wait is traced with the
+// task MoRef, e.g. to look up the task in vCenter. If ctx is done, e.g. on
+// timeout or shutdown, the task is cancelled in vCenter.
+func waitTask(ctx context.Context, task *object.Task) (err error) {
+	ctx, span := startSpan(ctx, "task.Wait", taskKey.String(task.Reference().Value))
+	defer func() { endSpan(span, err) }()
+
+	err = task.Wait(ctx)
+	if ctx.Err() == nil {
+		return err
+	}
+
+	// ctx is done, use a new one for cancelling
+	cancelCtx, cancel := context.WithTimeout(context.Background(), cancelTaskTimeout)
+	defer cancel()
+
+	// not all tasks are cancelable, e.g. when almost completed
+	if cerr := task.Cancel(cancelCtx); cerr != nil {
+		span.AddEvent(ctx, "could not cancel task", kv.String("error", cerr.Error()))
+	}
+	return errors.Wrapf(ctx.Err(), "task %s cancelled", task.Reference().Value)
+}
+
+func powerOnVM(ctx context.Context, vm *object.VirtualMachine) (err error) {
+	defer func(start time.Time) {
+		observeOperation(powerOnOperation, start, err)
+	}(time.Now())
+
+	ctx, span := startSpan(ctx, "powerOnVM", vmKey.String(vm.Name()))
+	defer func() { endSpan(span, err) }()
+
+	task, err := vm.PowerOn(ctx)
+	if err != nil {
+		return err
+	}
+
+	return waitTask(ctx, task)
+}
+
+// powerOffVM powers off vm if it is powered on
+func powerOffVM(ctx context.Context, vm *object.VirtualMachine) (err error) {
+	on, err := isPoweredOn(ctx, vm)
+	if err != nil || !on {
+		return err
+	}
+
+	defer func(start time.Time) {
+		observeOperation(powerOffOperation, start, err)
+	}(time.Now())
+
+	ctx, span := startSpan(ctx, "powerOffVM", vmKey.String(vm.Name()))
+	defer func() { endSpan(span, err) }()
+
+	task, err := vm.PowerOff(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not initiate power off task")
+	}
+	return waitTask(ctx, task)
+}
+
+func deleteVM(ctx context.Context, vm *object.VirtualMachine) (err error) {
+	defer func(start time.Time) {
+		observeOperation(destroyOperation, start, err)
+	}(time.Now())
+
+	ctx, span := startSpan(ctx, "deleteVM", vmKey.String(vm.Name()))
+	defer func() { endSpan(span, err) }()
 
 	// we don't care about any errors during power off
-	_ = task.Wait(ctx)
+	if task, perr := vm.PowerOff(ctx); perr == nil && task != nil {
+		_ = waitTask(ctx, task)
+	}
 
 	task, err := vm.Destroy(ctx)
 	if err != nil {
@@ -114,14 +427,17 @@ func deleteVM(ctx context.Context, vm *object.VirtualMachine) error {
 		return errors.Wrapf(err, "could not delete vm %q", vm.InventoryPath)
 	}
 
-	err = task.Wait(ctx)
+	err = waitTask(ctx, task)
 	if err != nil {
 		return errors.Wrap(err, "vm delete task failed")
 	}
 	return nil
 }
 
-func deleteFolder(ctx context.Context, group *object.Folder) error {
+func deleteFolder(ctx context.Context, group *object.Folder) (err error) {
+	ctx, span := startSpan(ctx, "deleteFolder")
+	defer func() { endSpan(span, err) }()
+
 	task, err := group.Destroy(ctx)
 	if err != nil {
 		if strings.Contains(err.Error(), alreadyDeletedErr) {
@@ -131,7 +447,7 @@ func deleteFolder(ctx context.Context, group *object.Folder) error {
 		return errors.Wrapf(err, "could not delete folder %q", group.InventoryPath)
 	}
 
-	err = task.Wait(ctx)
+	err = waitTask(ctx, task)
 	if err != nil {
 		return errors.Wrap(err, "folder delete task failed")
 	}
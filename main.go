@@ -27,12 +27,20 @@ import (
 	"github.com/pkg/errors"
 	"github.com/vmware/govmomi"
 	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/vapi/rest"
 	"github.com/vmware/govmomi/vim25/soap"
+	"go.opentelemetry.io/otel/api/global"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	vmv1alpha1 "codeconnect/operator/api/v1alpha1"
 	"codeconnect/operator/controllers"
@@ -40,9 +48,10 @@ import (
 )
 
 var (
-	scheme        = runtime.NewScheme()
-	setupLog      = ctrl.Log.WithName("setup")
-	defaultResync = 5 * time.Minute // relist interval to sync CRs with external state (vC)
+	scheme           = runtime.NewScheme()
+	setupLog         = ctrl.Log.WithName("setup")
+	defaultResync    = 5 * time.Minute // relist interval to sync CRs with external state (vC)
+	defaultKeepAlive = 5 * time.Minute // idle interval to keep vCenter sessions alive
 )
 
 func init() {
@@ -56,12 +65,37 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var insecure bool
+	var otlpEndpoint string
+	var paused bool
+	var enableWebhooks bool
+	var clusterID string
+	var externalMetricsAddr, externalMetricsCertDir, externalMetricsClientCA string
+	var cloneConcurrency, powerOnConcurrency, destroyConcurrency int
+	var maxConcurrentReconciles int
+	timeouts := controllers.DefaultTimeouts()
 
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
 	flag.BoolVar(&insecure, "insecure", false, "ignore any vCenter TLS cert validation error")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", controllers.DefaultConcurrency, "max number of VmGroups reconciled in parallel")
+	flag.IntVar(&cloneConcurrency, "clone-concurrency", controllers.DefaultConcurrency, "max number of parallel clone operations against vCenter")
+	flag.IntVar(&powerOnConcurrency, "power-on-concurrency", controllers.DefaultConcurrency, "max number of parallel power on operations against vCenter")
+	flag.IntVar(&destroyConcurrency, "destroy-concurrency", controllers.DefaultConcurrency, "max number of parallel destroy operations against vCenter")
+	flag.DurationVar(&timeouts.Reconcile, "reconcile-timeout", timeouts.Reconcile, "max duration of a reconcile operating on replicas")
+	flag.DurationVar(&timeouts.Clone, "clone-timeout", timeouts.Clone, "max duration of a clone operation, the vCenter task is cancelled on timeout")
+	flag.DurationVar(&timeouts.PowerOn, "power-on-timeout", timeouts.PowerOn, "max duration of a power on operation, the vCenter task is cancelled on timeout")
+	flag.DurationVar(&timeouts.Archive, "archive-timeout", timeouts.Archive, "max duration of archiving a replica before it is destroyed")
+	flag.DurationVar(&timeouts.Snapshot, "snapshot-timeout", timeouts.Snapshot, "max duration of creating, reverting or removing a snapshot of a replica")
+	flag.DurationVar(&timeouts.Destroy, "destroy-timeout", timeouts.Destroy, "max duration of a destroy operation, the vCenter task is cancelled on timeout")
+	flag.StringVar(&clusterID, "cluster-id", "", "ID of the Kubernetes cluster in vSphere tags, defaults to the kube-system namespace UID")
+	flag.BoolVar(&paused, "paused", false, "pause changes to replicas of all VmGroups, e.g. during vCenter maintenance")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false, "serve the admission webhooks, requires a certificate in /tmp/k8s-webhook-server/serving-certs")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", "", "OTLP collector address traces are exported to, e.g. localhost:55680 (tracing is disabled if empty)")
+	flag.StringVar(&externalMetricsAddr, "external-metrics-addr", "", "address the external metrics API for the HPA binds to, e.g. :6443 (disabled if empty)")
+	flag.StringVar(&externalMetricsCertDir, "external-metrics-cert-dir", "", "directory with tls.crt and tls.key of the external metrics API, a self-signed certificate is used if empty")
+	flag.StringVar(&externalMetricsClientCA, "external-metrics-client-ca", "", "CA file verifying client certificates of the external metrics API, the requestheader CA of the API server aggregation layer is used if empty")
 	flag.Parse()
 
 	// ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
@@ -83,6 +117,30 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// cancel in-flight vCenter operations on shutdown
+	err = mgr.Add(manager.RunnableFunc(func(stop <-chan struct{}) error {
+		<-stop
+		cancel()
+		return nil
+	}))
+	if err != nil {
+		setupLog.Error(err, "unable to add shutdown handler")
+		os.Exit(1)
+	}
+
+	if otlpEndpoint != "" {
+		exp, err := newTraceExporter(otlpEndpoint)
+		if err != nil {
+			setupLog.Error(err, "could not create trace exporter")
+			os.Exit(1)
+		}
+		defer func() {
+			if err := exp.Stop(); err != nil {
+				setupLog.Error(err, "could not stop trace exporter")
+			}
+		}()
+	}
+
 	vCenterURL := os.Getenv("VC_HOST")
 	vcUser := os.Getenv("VC_USER")
 	vcPass := os.Getenv("VC_PASS")
@@ -93,6 +151,22 @@ func main() {
 		os.Exit(1)
 	}
 
+	rc, err := newRestClient(ctx, vc, vcUser, vcPass)
+	if err != nil {
+		setupLog.Error(err, "could not connect to vCenter REST API", "controller", "VmGroup")
+		os.Exit(1)
+	}
+
+	controllers.KeepAlive(ctx, vc, rc, url.UserPassword(vcUser, vcPass), defaultKeepAlive, setupLog.WithName("session"))
+
+	if clusterID == "" {
+		clusterID, err = getClusterID(ctx, mgr.GetAPIReader())
+		if err != nil {
+			setupLog.Error(err, "could not get cluster ID")
+			os.Exit(1)
+		}
+	}
+
 	finder := find.NewFinder(vc.Client)
 
 	// TODO: make configurable, e.g. in spec
@@ -103,25 +177,135 @@ func main() {
 	}
 	finder.SetDatacenter(dc)
 
-	// TODO: make configurable, e.g. in spec
+	// default pool, can be overridden per VmGroup with spec.placement
 	rp, err := finder.DefaultResourcePool(ctx)
 	if err != nil {
 		setupLog.Error(err, "could not get default resource pool")
 		os.Exit(1)
 	}
 
+	// shared by all reconcilers operating on replicas
+	limiter := controllers.NewLimiter(cloneConcurrency, powerOnConcurrency, destroyConcurrency)
+
 	if err = (&controllers.VmGroupReconciler{
+		Client:                  mgr.GetClient(),
+		APIReader:               mgr.GetAPIReader(),
+		VC:                      vc,
+		Rest:                    rc,
+		Recorder:                mgr.GetEventRecorderFor("vmgroup-controller"),
+		Limiter:                 limiter,
+		Timeouts:                timeouts,
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+		Context:                 ctx,
+		Paused:                  paused,
+		Tagger:                  controllers.NewTagger(rc, clusterID),
+		Finder:                  finder,
+		ResourcePool:            rp,
+		Log:                     ctrl.Log.WithName("controllers").WithName("VmGroup"),
+		Scheme:                  mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "VmGroup")
+		os.Exit(1)
+	}
+
+	if err = (&controllers.VmTemplateReconciler{
+		Client:   mgr.GetClient(),
+		Finder:   finder,
+		Rest:     rc,
+		Timeouts: timeouts,
+		Context:  ctx,
+		Log:      ctrl.Log.WithName("controllers").WithName("VmTemplate"),
+		Scheme:   mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "VmTemplate")
+		os.Exit(1)
+	}
+
+	if err = (&controllers.VmGroupSnapshotReconciler{
+		Client:   mgr.GetClient(),
+		Finder:   finder,
+		Limiter:  limiter,
+		Timeouts: timeouts,
+		Context:  ctx,
+		Paused:   paused,
+		Log:      ctrl.Log.WithName("controllers").WithName("VmGroupSnapshot"),
+		Scheme:   mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "VmGroupSnapshot")
+		os.Exit(1)
+	}
+
+	if err = (&controllers.VmGroupScheduleReconciler{
+		Client:   mgr.GetClient(),
+		Recorder: mgr.GetEventRecorderFor("vmgroupschedule-controller"),
+		Timeouts: timeouts,
+		Context:  ctx,
+		Log:      ctrl.Log.WithName("controllers").WithName("VmGroupSchedule"),
+		Scheme:   mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "VmGroupSchedule")
+		os.Exit(1)
+	}
+
+	if err = (&controllers.VmGroupAutoscalerReconciler{
+		Client:   mgr.GetClient(),
+		Finder:   finder,
+		Recorder: mgr.GetEventRecorderFor("vmgroupautoscaler-controller"),
+		Timeouts: timeouts,
+		Context:  ctx,
+		Log:      ctrl.Log.WithName("controllers").WithName("VmGroupAutoscaler"),
+		Scheme:   mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "VmGroupAutoscaler")
+		os.Exit(1)
+	}
+
+	if err = (&controllers.VmNamespaceConfigReconciler{
 		Client:       mgr.GetClient(),
-		VC:           vc,
 		Finder:       finder,
 		ResourcePool: rp,
-		Log:          ctrl.Log.WithName("controllers").WithName("VmGroup"),
+		Timeouts:     timeouts,
+		Context:      ctx,
+		Log:          ctrl.Log.WithName("controllers").WithName("VmNamespaceConfig"),
 		Scheme:       mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "VmGroup")
+		setupLog.Error(err, "unable to create controller", "controller", "VmNamespaceConfig")
 		os.Exit(1)
 	}
 
+	if err = (&controllers.VmQuotaReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("VmQuota"),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "VmQuota")
+		os.Exit(1)
+	}
+
+	if enableWebhooks {
+		mgr.GetWebhookServer().Register(controllers.VmGroupValidatorPath, &webhook.Admission{
+			Handler: &controllers.VmGroupValidator{Client: mgr.GetClient()},
+		})
+		mgr.GetWebhookServer().Register(controllers.VmNamespaceConfigValidatorPath, &webhook.Admission{
+			Handler: &controllers.VmNamespaceConfigValidator{Client: mgr.GetClient()},
+		})
+	}
+
+	if externalMetricsAddr != "" {
+		err = mgr.Add(&controllers.ExternalMetricsServer{
+			Client:       mgr.GetClient(),
+			APIReader:    mgr.GetAPIReader(),
+			Finder:       finder,
+			Addr:         externalMetricsAddr,
+			CertDir:      externalMetricsCertDir,
+			ClientCAFile: externalMetricsClientCA,
+			Log:          ctrl.Log.WithName("externalmetrics"),
+		})
+		if err != nil {
+			setupLog.Error(err, "unable to add external metrics server")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	setupLog.Info("starting manager")
@@ -149,3 +333,43 @@ func newClient(ctx context.Context, vc, user, pass string, insecure bool) (*govm
 
 	return c, nil
 }
+
+// getClusterID returns the UID of the kube-system namespace which is unique per
+// cluster
+func getClusterID(ctx context.Context, c client.Reader) (string, error) {
+	var ns corev1.Namespace
+	if err := c.Get(ctx, client.ObjectKey{Name: "kube-system"}, &ns); err != nil {
+		return "", fmt.Errorf("could not get kube-system namespace: %v", err)
+	}
+
+	return string(ns.UID), nil
+}
+
+// newTraceExporter registers a global trace provider exporting spans to the
+// OTLP collector at endpoint
+func newTraceExporter(endpoint string) (*otlp.Exporter, error) {
+	exp, err := otlp.NewExporter(otlp.WithInsecure(), otlp.WithAddress(endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("could not create OTLP exporter: %v", err)
+	}
+
+	tp, err := sdktrace.NewProvider(
+		sdktrace.WithConfig(sdktrace.Config{DefaultSampler: sdktrace.AlwaysSample()}),
+		sdktrace.WithBatcher(exp),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not create trace provider: %v", err)
+	}
+
+	global.SetTraceProvider(tp)
+	return exp, nil
+}
+
+func newRestClient(ctx context.Context, vc *govmomi.Client, user, pass string) (*rest.Client, error) {
+	c := rest.NewClient(vc.Client)
+	if err := c.Login(ctx, url.UserPassword(user, pass)); err != nil {
+		return nil, fmt.Errorf("could not login to vCenter REST API: %v", err)
+	}
+
+	return c, nil
+}